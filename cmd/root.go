@@ -1,14 +1,21 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/livinlefevreloca/canopy/internal/backend"
+	"github.com/livinlefevreloca/canopy/internal/credserver"
+	"github.com/livinlefevreloca/canopy/internal/daemon"
 	"github.com/livinlefevreloca/canopy/internal/ipc"
 	"github.com/livinlefevreloca/canopy/internal/logging"
+	"github.com/livinlefevreloca/canopy/internal/recording"
 	"github.com/livinlefevreloca/canopy/internal/tui"
 	"github.com/spf13/cobra"
 )
@@ -23,12 +30,56 @@ var (
 				daily driver for managing your aws resources.`,
 		Run: RunRootCmd,
 	}
+	daemonCmd = &cobra.Command{
+		Use:   "daemon",
+		Short: "Run the canopy backend as a daemon that TUI windows can attach to",
+		Long: `Run the canopy backend in the background on a unix socket. Start the TUI with
+				--attach to use it, any number of TUI windows can share one daemon and the
+				credentials it holds.`,
+		Run: RunDaemonCmd,
+	}
+	serveCredentialsCmd = &cobra.Command{
+		Use:   "serve-credentials",
+		Short: "Serve the active credentials to local tools on an ECS compatible endpoint",
+		Long: `Run the canopy daemon and serve the credentials of its active identity on a
+				localhost endpoint compatible with the ECS container credentials protocol.
+				Export the printed variables for docker containers or other tools to use it.
+				Switching profile in a TUI attached with --attach switches what is served.
+
+				The endpoint only listens on loopback, the SDKs refuse to fetch credentials
+				over plain http from any other host. Containers on the default bridge network
+				cannot reach it: run them with --network host so the printed URL works as is.
+				Where that is not available, as on Docker Desktop, forward a loopback port
+				inside the container to host.docker.internal and point
+				AWS_CONTAINER_CREDENTIALS_FULL_URI at that port instead, for example
+				socat TCP-LISTEN:<port>,bind=127.0.0.1,fork TCP:host.docker.internal:<port>`,
+		Run: RunServeCredentialsCmd,
+	}
 	rootArgs struct {
 		Profile string
 		Region  string
+		Socket  string
+		Attach  bool
+		Record  string
+		Replay  string
+		Listen  string
 	}
 )
 
+// Exit statuses. A signal exits with 128 + the signal number like a shell would.
+const (
+	EXIT_OK      = 0
+	EXIT_ERROR   = 1 // Canopy failed to start or run
+	EXIT_TIMEOUT = 2 // The backend did not stop in time during shutdown
+)
+
+// How long shutdown waits for the backend to stop before giving up on it.
+// Longer than the server's own timeout so it can report its handlers first.
+const SHUTDOWN_TIMEOUT = backend.SHUTDOWN_TIMEOUT + 2*time.Second
+
+// Signals that stop canopy
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
 func RunRootCmd(cmd *cobra.Command, args []string) {
 
 	os.Rename("./.canopy.log", fmt.Sprintf("./.canopy.log.bak-%d", time.Now().Unix())) // Backup previous log file if it exists
@@ -39,22 +90,231 @@ func RunRootCmd(cmd *cobra.Command, args []string) {
 		Json:     false,
 	})
 
-	tx := make(chan ipc.Trigger, 100) // Buffered channel for outgoing triggers
-	server := backend.NewServer(&tx, rootArgs.Profile, rootArgs.Region)
-	go server.Run()
-	requestHandler := ipc.NewTriggerHandler(&tx)
+	tx := make(chan ipc.Trigger, 100)   // Buffered channel for outgoing triggers
+	push := make(chan []ipc.Event, 100) // Buffered channel for events pushed by the server
+	if err := startBackend(&tx, &push); err != nil {
+		slog.Error("Failed to start backend", "error", err)
+		fmt.Fprintf(os.Stderr, "Failed to start canopy: %s\n", err)
+		exit(EXIT_ERROR)
+	}
+	requestHandler := ipc.NewTriggerHandler(&tx, &push)
 	tui := tui.NewTui(requestHandler)
-	err := tui.Run()
-	if err != nil {
+
+	coordinator := newShutdown(&tx, requestHandler, tui)
+	tui.SetOnQuit(func() { coordinator.begin(EXIT_OK, "quit requested") })
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, shutdownSignals...)
+	defer signal.Stop(signals)
+	go func() {
+		sig := <-signals
+		coordinator.begin(signalStatus(sig), "received "+sig.String())
+	}()
+
+	if err := tui.Run(); err != nil {
 		slog.Error("Failed to run TUI", "error", err)
-		return
+		fmt.Fprintf(os.Stderr, "Failed to run canopy: %s\n", err)
+		coordinator.begin(EXIT_ERROR, "tui failed")
+	}
+	// The application stops once shutdown finished, unless it stopped on its own
+	coordinator.begin(EXIT_OK, "tui stopped")
+	exit(coordinator.wait())
+}
+
+// shutdown coordinates stopping canopy so it happens the same way whether the
+// user quit, a signal was received or the tui failed: outstanding triggers are
+// cancelled, the backend is told to quit and waits for its handlers, then the
+// application is stopped to restore the terminal.
+type shutdown struct {
+	tx             *chan ipc.Trigger
+	triggerHandler *ipc.TriggerHandler
+	tui            *tui.Tui
+	once           sync.Once
+	status         int           // Exit status, only read after done is closed
+	done           chan struct{} // Closed once shutdown has finished
+}
+
+func newShutdown(tx *chan ipc.Trigger, triggerHandler *ipc.TriggerHandler, tui *tui.Tui) *shutdown {
+	return &shutdown{
+		tx:             tx,
+		triggerHandler: triggerHandler,
+		tui:            tui,
+		done:           make(chan struct{}),
+	}
+}
+
+// Start shutting down with the given exit status. Only the first call has any effect.
+func (s *shutdown) begin(status int, reason string) {
+	s.once.Do(func() {
+		slog.Info("Shutting down", "reason", reason, "status", status, "outstanding", s.triggerHandler.Outstanding())
+		s.status = status
+		go s.run()
+	})
+}
+
+func (s *shutdown) run() {
+	defer close(s.done)
+	s.triggerHandler.CancelOutstanding()
+	if !stopBackend(s.tx, SHUTDOWN_TIMEOUT) {
+		s.status = EXIT_TIMEOUT
+	}
+	s.tui.Stop()
+}
+
+// Wait for shutdown to finish and return the exit status.
+func (s *shutdown) wait() int {
+	<-s.done
+	return s.status
+}
+
+// Send the backend a quit trigger and wait for it to answer. Returns false if
+// it did not answer within the timeout.
+func stopBackend(tx *chan ipc.Trigger, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	quit := ipc.NewTrigger(ctx, ipc.Event{Component: ipc.COMPONENT_QUIT, Action: ipc.ACTION_END})
+	select {
+	case *tx <- quit:
+	case <-ctx.Done():
+		slog.Error("Backend did not accept the quit trigger")
+		return false
+	}
+	for {
+		select {
+		case _, open := <-quit.Responder:
+			if !open {
+				slog.Info("Backend stopped")
+				return true
+			}
+		case <-ctx.Done():
+			slog.Error("Backend did not stop before the shutdown timeout", "timeout", timeout)
+			return false
+		}
+	}
+}
+
+// The exit status for being stopped by a signal.
+func signalStatus(sig os.Signal) int {
+	if number, ok := sig.(syscall.Signal); ok {
+		return 128 + int(number)
+	}
+	return EXIT_ERROR
+}
+
+// Flush the logs and exit.
+func exit(status int) {
+	slog.Info("Exiting", "status", status)
+	if err := logging.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to flush log file: %s\n", err)
+	}
+	os.Exit(status)
+}
+
+// Start whatever answers the TUI's triggers: a recording being replayed, a
+// daemon or, by default, a backend server in this process. If recording, the
+// recorder sits in between and the backend talks to it instead.
+func startBackend(tx *chan ipc.Trigger, push *chan []ipc.Event) error {
+	if rootArgs.Record != "" {
+		recorder, err := recording.NewRecorder(rootArgs.Record, tx, push)
+		if err != nil {
+			return fmt.Errorf("failed to create recording %s: %w", rootArgs.Record, err)
+		}
+		tx, push = recorder.Backend()
+		go recorder.Run()
+	}
+
+	switch {
+	case rootArgs.Replay != "":
+		replayer, err := recording.NewReplayer(rootArgs.Replay, tx, push)
+		if err != nil {
+			return fmt.Errorf("failed to load recording %s: %w", rootArgs.Replay, err)
+		}
+		go replayer.Run()
+	case rootArgs.Attach:
+		client, err := daemon.NewClient(tx, push, rootArgs.Socket)
+		if err != nil {
+			return fmt.Errorf("failed to attach to the canopy daemon at %s: %w", rootArgs.Socket, err)
+		}
+		go client.Run()
+	default:
+		server := backend.NewServer(tx, push, rootArgs.Profile, rootArgs.Region)
+		go server.Run()
+	}
+	return nil
+}
+
+func RunDaemonCmd(cmd *cobra.Command, args []string) {
+	runDaemon(nil)
+}
+
+// Run the daemon with a credentials endpoint and print how to use it.
+func RunServeCredentialsCmd(cmd *cobra.Command, args []string) {
+	runDaemon(func(server *backend.Server) error {
+		credentials, err := server.StartCredentialsServer(rootArgs.Listen)
+		if err != nil {
+			return fmt.Errorf("failed to start the credentials endpoint: %w", err)
+		}
+		for _, variable := range credentials.Env() {
+			fmt.Println("export " + variable)
+		}
+		return nil
+	})
+}
+
+// Run a backend server behind the daemon socket until a shutdown signal. If
+// given, started is called once the server has been created.
+func runDaemon(started func(*backend.Server) error) {
+
+	os.Rename("./.canopy-daemon.log", fmt.Sprintf("./.canopy-daemon.log.bak-%d", time.Now().Unix())) // Backup previous log file if it exists
+
+	logging.ConfigureLogger(logging.LoggingConfig{
+		LogLevel: "DEBUG",
+		LogFile:  "./.canopy-daemon.log",
+		Json:     false,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
+	defer stop()
+
+	tx := make(chan ipc.Trigger, 100)   // Buffered channel for incoming triggers
+	push := make(chan []ipc.Event, 100) // Buffered channel for events pushed by the server
+	server := backend.NewServer(&tx, &push, rootArgs.Profile, rootArgs.Region)
+	go server.Run()
+
+	status := EXIT_OK
+	if started != nil {
+		if err := started(server); err != nil {
+			slog.Error("Daemon failed to start", "error", err)
+			fmt.Fprintf(os.Stderr, "canopy daemon failed: %s\n", err)
+			stopBackend(&tx, SHUTDOWN_TIMEOUT)
+			exit(EXIT_ERROR)
+		}
+	}
+	d := daemon.NewDaemon(&tx, &push, rootArgs.Socket)
+	if err := d.Serve(ctx); err != nil {
+		slog.Error("Daemon failed", "error", err)
+		fmt.Fprintf(os.Stderr, "canopy daemon failed: %s\n", err)
+		status = EXIT_ERROR
 	}
 
+	// Stop the server the same way the TUI does
+	if !stopBackend(&tx, SHUTDOWN_TIMEOUT) && status == EXIT_OK {
+		status = EXIT_TIMEOUT
+	}
+	stop()
+	exit(status)
 }
 
 func Run() error {
 	rootCmd.PersistentFlags().StringVarP(&rootArgs.Profile, "profile", "p", "", "AWS profile to use")
 	rootCmd.PersistentFlags().StringVarP(&rootArgs.Region, "region", "r", "", "AWS region to use")
+	rootCmd.PersistentFlags().StringVar(&rootArgs.Socket, "socket", daemon.DefaultSocketPath(), "Unix socket of the canopy daemon")
+	rootCmd.Flags().BoolVarP(&rootArgs.Attach, "attach", "a", false, "Attach to a running canopy daemon instead of starting a backend in process")
+	rootCmd.Flags().StringVar(&rootArgs.Record, "record", "", "Record all IPC traffic, with secrets redacted, to a file")
+	rootCmd.Flags().StringVar(&rootArgs.Replay, "replay", "", "Replay a recording made with --record instead of talking to AWS")
+	rootCmd.MarkFlagsMutuallyExclusive("attach", "replay")
+	serveCredentialsCmd.Flags().StringVar(&rootArgs.Listen, "listen", credserver.DEFAULT_ADDRESS, "Loopback address to serve the credentials on, containers need --network host to reach it")
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(serveCredentialsCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		return err
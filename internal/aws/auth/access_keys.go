@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"log/slog"
+)
+
+// Mode of the credentials file, it holds secret keys so only the user may read it
+const CREDENTIALS_FILE_MODE = 0600
+
+// SaveAccessKeysProfile writes access keys to a profile in the credentials
+// file. An existing profile gets the new keys and keeps its other settings.
+func SaveAccessKeysProfile(name string, accessKeyID string, secretAccessKey string, sessionToken string, region string) error {
+	file, err := readIniFile(CredentialsFilePath())
+	if err != nil {
+		return err
+	}
+	section, exists := file.section(name) // Sections of the credentials file have no "profile " prefix
+	if !exists {
+		section = file.addSection(name, nil)
+	}
+	section.set("aws_access_key_id", accessKeyID)
+	section.set("aws_secret_access_key", secretAccessKey)
+	if sessionToken != "" {
+		section.set("aws_session_token", sessionToken)
+	} else {
+		section.unset("aws_session_token") // Left over from previous temporary keys
+	}
+	if region != "" && !exists {
+		section.set("region", region)
+	}
+	// Always restrict the permissions, the file may have been created with looser ones
+	if err := file.write(CREDENTIALS_FILE_MODE); err != nil {
+		return err
+	}
+	slog.Info("Saved access keys", "profile", name, "file", file.path, "updated", exists)
+	return nil
+}
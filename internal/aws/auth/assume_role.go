@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// AssumeRoleInput describes a role to assume from the current identity.
+type AssumeRoleInput struct {
+	RoleARN     string
+	SessionName string
+	Duration    time.Duration // 0 uses the role's default
+	ExternalID  string        // Optional
+}
+
+// AssumeRole assumes a role with the credentials of source and returns a config
+// for the role. The credentials are refreshed from source when they expire.
+// The returned config remembers source so the caller can step back to it.
+func AssumeRole(ctx context.Context, source *AWSConfig, input AssumeRoleInput) (*AWSConfig, error) {
+	if input.RoleARN == "" {
+		return nil, errors.New("a role ARN is required")
+	}
+	slog.InfoContext(ctx, "Assuming role", "roleArn", input.RoleARN, "sessionName", input.SessionName, "from", source.Identity())
+
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(*source.Config), input.RoleARN, func(options *stscreds.AssumeRoleOptions) {
+		if input.SessionName != "" {
+			options.RoleSessionName = input.SessionName
+		}
+		if input.Duration > 0 {
+			options.Duration = input.Duration
+		}
+		if input.ExternalID != "" {
+			options.ExternalID = aws.String(input.ExternalID)
+		}
+	})
+	cfg := source.Config.Copy()
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to assume role", "roleArn", input.RoleARN, "error", err)
+		return nil, err
+	}
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get identity of assumed role", "roleArn", input.RoleARN, "error", err)
+		return nil, err
+	}
+
+	configData := source.AWSConfigData
+	configData.AuthType = string(AUTH_TYPE_ASSUME_ROLE)
+	configData.AccountId = aws.ToString(identity.Account)
+	configData.AssumeRoleARN = aws.ToString(identity.Arn)
+	configData.AccessKeyID = creds.AccessKeyID
+	configData.CredentialsSource = creds.Source
+	configData.Expires = expiresAt(creds)
+	configData.RoleChain = append(append(make([]string, 0, len(source.RoleChain)+1), source.RoleChain...), source.Identity())
+
+	return &AWSConfig{
+		AWSConfigData: configData,
+		Profile:       source.Profile,
+		Config:        &cfg,
+		Previous:      source,
+	}, nil
+}
+
+// Identity describes who the config acts as, for showing the role chain.
+func (c *AWSConfig) Identity() string {
+	switch {
+	case c.AssumeRoleARN != "":
+		return c.AssumeRoleARN
+	case c.Profile != nil:
+		return "profile " + c.Profile.Name
+	default:
+		return "access key " + c.AccessKeyID
+	}
+}
@@ -1,8 +1,9 @@
 package auth
 
 import (
-	"bufio"
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
@@ -11,13 +12,15 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
 	"github.com/livinlefevreloca/canopy/internal/ipc"
 )
 
 type AWSConfig struct {
 	ipc.AWSConfigData
-	SharedConfig *config.SharedConfig
-	Config       *aws.Config
+	Profile  *Profile // The profile from the config files, nil when using access keys
+	Config   *aws.Config
+	Previous *AWSConfig // The config a role was assumed from, nil if no role was assumed in canopy
 }
 
 type SSOLoginError struct {
@@ -28,125 +31,176 @@ func (e *SSOLoginError) Error() string {
 	return e.Message
 }
 
-func GetAwsConfigFromProfileConfig(profile string, region string) (*AWSConfig, error) {
-	ctx := context.Background()
+// GetAwsConfigFromProfileConfig loads the config of a profile and checks that
+// its credentials can be retrieved. Profiles with an mfa_serial get their codes
+// from mfa, if mfa is nil they fail to load.
+func GetAwsConfigFromProfileConfig(ctx context.Context, profile string, region string, mfa *MFASessions) (*AWSConfig, error) {
+	profile = ResolveProfile(profile)
 
-	if profile == "" {
-		profile = getAWSProfile()
-	}
-
-	slog.Info("Using AWS profile", "profile", profile)
+	slog.InfoContext(ctx, "Using AWS profile", "profile", profile)
 
 	if region == "" {
-		region = getAWSRegion(profile)
+		region = EnvRegion()
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(profile), config.WithDefaultRegion(region))
+	options := []func(*config.LoadOptions) error{
+		config.WithSharedConfigProfile(profile),
+		config.WithDefaultRegion(region),
+		config.WithAPIOptions(apiOptions),
+	}
+	if mfa != nil {
+		options = append(options, mfa.loadOption(ctx))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
 	if err != nil {
-		slog.Error("failed to load config", "error", err)
+		slog.ErrorContext(ctx, "failed to load config", "error", err)
 		return nil, err
 	}
 
-	sharedCfg, err := config.LoadSharedConfigProfile(ctx, profile)
+	profiles, err := LoadProfiles()
 	if err != nil {
-		slog.Error("failed to load shared config", "error", err)
+		slog.ErrorContext(ctx, "failed to load profiles", "error", err)
+		return nil, err
+	}
+	profileModel, ok := profiles.Get(profile)
+	if !ok {
+		// The SDK loaded it so it must come from somewhere, e.g. only the environment
+		profileModel = &Profile{Name: profile, AuthType: AUTH_TYPE_NONE}
+	}
+	usesMFA := mfa != nil && requiresMFA(profiles, profile)
+	if usesMFA {
+		cfg.Credentials = mfa.session(profile, cfg.Credentials)
 	}
 
 	if region == "" {
 		region = cfg.Region
 	}
-	slog.Info("Using AWS Region", "region", region)
+	slog.InfoContext(ctx, "Using AWS Region", "region", region)
 
-	creds, err := cfg.Credentials.Retrieve(ctx)
+	creds, err := RetrieveCredentials(ctx, &cfg)
 	if err != nil {
-		slog.Error("failed to retrieve credentials", "error", err)
-		if strings.Contains(err.Error(), "the SSO session has expired or is invalid") {
-			msg := "SSO session is expired or invalid"
-			slog.Error(msg)
-			return nil, &SSOLoginError{
-				Message: msg,
-			}
+		if usesMFA {
+			mfa.Forget(profile) // Start over with a new code next time
 		}
 		return nil, err
 	}
 
-	slog.Info("Using credentials with source", "source", creds.Source)
+	slog.InfoContext(ctx, "Using credentials with source", "source", creds.Source)
 
 	accountId, err := getAccountId(ctx, &cfg)
 	if err != nil {
-		slog.Error("failed to get account ID", "error", err)
+		slog.ErrorContext(ctx, "failed to get account ID", "error", err)
 	}
 
 	configData := ipc.AWSConfigData{
 		Profile:           profile,
-		SSORoleName:       sharedCfg.SSORoleName,
+		AuthType:          string(profileModel.AuthType),
+		SSORoleName:       profileModel.SSORoleName,
 		AccountId:         accountId,
-		AssumeRoleARN:     "",
+		AssumeRoleARN:     profileModel.RoleARN,
 		AccessKeyID:       creds.AccessKeyID,
 		CredentialsSource: creds.Source,
+		Expires:           expiresAt(creds),
 		Region:            region,
 	}
 
 	return &AWSConfig{
 		AWSConfigData: configData,
-		SharedConfig:  &sharedCfg,
+		Profile:       profileModel,
 		Config:        &cfg,
 	}, nil
 }
 
-func GetAwsFromAccessKeys(accessKeyID, secretAccessKey, region string) (*AWSConfig, error) {
-	ctx := context.Background()
+// RetrieveCredentials gets the credentials for a config, refreshing them if they
+// have expired. An expired SSO session is returned as an SSOLoginError.
+func RetrieveCredentials(ctx context.Context, cfg *aws.Config) (aws.Credentials, error) {
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to retrieve credentials", "error", err)
+		if strings.Contains(err.Error(), "the SSO session has expired or is invalid") {
+			msg := "SSO session is expired or invalid"
+			slog.ErrorContext(ctx, msg)
+			return creds, &SSOLoginError{
+				Message: msg,
+			}
+		}
+		return creds, err
+	}
+	return creds, nil
+}
 
+// IsSSOExpired reports whether err was caused by an expired or invalid SSO session.
+func IsSSOExpired(err error) bool {
+	var ssoErr *SSOLoginError
+	return errors.As(err, &ssoErr)
+}
+
+// GetAwsFromAccessKeys creates a config for access keys and validates them
+// with STS. The session token is only set for temporary keys.
+func GetAwsFromAccessKeys(ctx context.Context, accessKeyID, secretAccessKey, sessionToken, region string) (*AWSConfig, error) {
 	if accessKeyID == "" || secretAccessKey == "" {
-		return nil, nil // or return an error if you prefer
+		return nil, errors.New("an access key ID and secret access key are required")
 	}
 
-	slog.Info("Using AWS Access Keys", "AccessKeyID", accessKeyID)
+	slog.InfoContext(ctx, "Using AWS Access Keys", "AccessKeyID", accessKeyID, "temporary", sessionToken != "")
 
 	if region == "" {
-		region = getAWSRegion("")
+		region = EnvRegion()
 	}
 
 	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, "")),
-		config.WithDefaultRegion(region))
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken)),
+		config.WithDefaultRegion(region),
+		config.WithAPIOptions(apiOptions))
 
 	if err != nil {
-		slog.Error("failed to load config with access keys", "error", err)
+		slog.ErrorContext(ctx, "failed to load config with access keys", "error", err)
 		return nil, err
 	}
 
 	creds, err := cfg.Credentials.Retrieve(ctx)
 	if err != nil {
-		slog.Error("failed to retrieve credentials", "error", err)
+		slog.ErrorContext(ctx, "failed to retrieve credentials", "error", err)
 		return nil, err
 	}
 
-	slog.Info("Using credentials with source", "source", creds.Source)
+	slog.InfoContext(ctx, "Using credentials with source", "source", creds.Source)
 
+	// Static keys are not checked until they are used, ask STS who they belong to so bad keys are caught now
 	accountId, err := getAccountId(ctx, &cfg)
 	if err != nil {
-		slog.Error("failed to get account ID", "error", err)
+		slog.ErrorContext(ctx, "access keys were rejected", "error", err)
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			return nil, fmt.Errorf("the access keys were rejected: %s", apiErr.ErrorMessage())
+		}
+		return nil, err
 	}
 
 	configData := ipc.AWSConfigData{
 		Profile:           "",
+		AuthType:          string(AUTH_TYPE_STATIC),
 		SSORoleName:       "",
 		AccountId:         accountId,
 		AssumeRoleARN:     "",
 		AccessKeyID:       accessKeyID,
 		CredentialsSource: creds.Source,
 		Region:            region,
+		Expires:           expiresAt(creds),
 	}
 
 	return &AWSConfig{
 		AWSConfigData: configData,
 		Config:        &cfg,
-		SharedConfig:  nil, // No shared config for access keys
+		Profile:       nil, // No profile for access keys
 	}, nil
 }
 
-func getAWSProfile() string {
+// ResolveProfile returns the profile, or the one the SDK uses by default if it is empty.
+func ResolveProfile(profile string) string {
+	if profile != "" {
+		return profile
+	}
 	if profile := os.Getenv("AWS_PROFILE"); profile != "" {
 		return profile
 	}
@@ -156,6 +210,13 @@ func getAWSProfile() string {
 	return config.DefaultSharedConfigProfile // "default"
 }
 
+// VerifyRegion checks the credentials can be used in the region of the config.
+// Opt in regions the account has not enabled reject them.
+func (c *AWSConfig) VerifyRegion(ctx context.Context) error {
+	_, err := getAccountId(ctx, c.Config)
+	return err
+}
+
 func getAccountId(ctx context.Context, cfg *aws.Config) (string, error) {
 	client := sts.NewFromConfig(*cfg)
 	output, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
@@ -165,7 +226,8 @@ func getAccountId(ctx context.Context, cfg *aws.Config) (string, error) {
 	return *output.Account, nil
 }
 
-func getAWSRegion(profile string) string {
+// EnvRegion returns the region set in the environment, empty if there is none.
+func EnvRegion() string {
 	if region := os.Getenv("AWS_REGION"); region != "" {
 		return region
 	}
@@ -176,64 +238,12 @@ func getAWSRegion(profile string) string {
 	return ""
 }
 
-func GetAvailableProfiles() []string {
-	var credentialFile, configFile string
-	if credentialFile = os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); credentialFile == "" {
-		credentialFile = config.DefaultSharedCredentialsFilename()
-	}
-	if configFile = os.Getenv("AWS_CONFIG_FILE"); configFile == "" {
-		configFile = config.DefaultSharedConfigFilename()
-	}
-	profiles := make(map[string]struct{})
-	if credProfiles, err := getProfilesFromFile(credentialFile); err == nil {
-		for _, profile := range credProfiles {
-			if _, exists := profiles[profile]; !exists {
-				profiles[profile] = struct{}{}
-			}
-		}
-	} else {
-		slog.Error("Failed to get profiles from credentials file", "error", err)
-	}
-	if configProfiles, err := getProfilesFromFile(configFile); err == nil {
-		for _, profile := range configProfiles {
-			if _, exists := profiles[profile]; !exists {
-				profiles[profile] = struct{}{}
-			}
-		}
-	} else {
-		slog.Error("Failed to get profiles from config file", "error", err)
-	}
-	profileList := make([]string, 0, len(profiles))
-	for profile := range profiles {
-		profileList = append(profileList, profile)
-	}
-	return profileList
-}
-
-func getProfilesFromFile(filePath string) ([]string, error) {
-	file, err := os.Open(filePath)
+// GetAvailableProfiles returns every profile from the AWS config and credentials files.
+func GetAvailableProfiles() []*Profile {
+	profiles, err := LoadProfiles()
 	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var profiles []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if strings.HasPrefix(line, "[profile ") && strings.HasSuffix(line, "]") {
-			// Extract profile name from the line
-			profile := strings.TrimPrefix(line, "[profile ")
-			profile = strings.TrimSuffix(profile, "]")
-			if profile != "" {
-				profiles = append(profiles, profile)
-			}
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, err
+		slog.Error("Failed to load AWS profiles", "error", err)
+		return make([]*Profile, 0)
 	}
-
-	return profiles, nil
+	return profiles.Profiles
 }
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// Kinds of the blocks of the config file that can be edited
+const (
+	CONFIG_SECTION_PROFILE     = "profile"
+	CONFIG_SECTION_SSO_SESSION = "sso-session"
+)
+
+// Limits of duration_seconds, from the AssumeRole API
+const (
+	MIN_ROLE_DURATION_SECONDS = 900
+	MAX_ROLE_DURATION_SECONDS = 43200
+)
+
+// Values credential_source can have
+var credentialSources = []string{"Environment", "Ec2InstanceMetadata", "EcsContainer"}
+
+var (
+	sectionNamePattern = regexp.MustCompile(`^[^\s\[\]]+$`)
+	keyPattern         = regexp.MustCompile(`^[a-z0-9_]+$`)
+	regionPattern      = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+	accountIDPattern   = regexp.MustCompile(`^\d{12}$`)
+	roleARNPattern     = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/\S+$`)
+)
+
+// ConfigSection is a profile or sso-session block of the config file.
+type ConfigSection struct {
+	Kind       string      // CONFIG_SECTION_PROFILE or CONFIG_SECTION_SSO_SESSION
+	Name       string      // Name without the kind, e.g. "dev" for [profile dev]
+	Properties [][2]string // Key and value of each setting, in the order they are in the file
+}
+
+// The name of the section in the file. The default profile has no prefix.
+func (c ConfigSection) sectionName() string {
+	return configSectionName(c.Kind, c.Name)
+}
+
+func configSectionName(kind string, name string) string {
+	if kind == CONFIG_SECTION_PROFILE && name == config.DefaultSharedConfigProfile {
+		return name
+	}
+	return kind + " " + name
+}
+
+// The kind and name of a section of the config file, false if it is neither a
+// profile nor an sso-session, like [services x] or a name without the profile prefix.
+func configSectionKind(sectionName string) (string, string, bool) {
+	kind, name := splitSectionName(sectionName)
+	switch {
+	case (kind == CONFIG_SECTION_PROFILE || kind == CONFIG_SECTION_SSO_SESSION) && name != "":
+		return kind, name, true
+	case kind == "" && name == config.DefaultSharedConfigProfile:
+		return CONFIG_SECTION_PROFILE, name, true
+	}
+	return "", "", false
+}
+
+// Find a profile or sso-session in the config file.
+func (f *iniFile) configSection(kind string, name string) (*iniSection, bool) {
+	for _, section := range f.sections {
+		if sectionKind, sectionName, ok := configSectionKind(section.name); ok && sectionKind == kind && sectionName == name {
+			return section, true
+		}
+	}
+	return nil, false
+}
+
+// LoadConfigSections lists the profiles and sso-sessions of the config file in
+// the order they are in it. Profiles only in the credentials file are not included.
+func LoadConfigSections() ([]ConfigSection, error) {
+	file, err := readIniFile(ConfigFilePath())
+	if err != nil {
+		return nil, err
+	}
+	sections := make([]ConfigSection, 0)
+	for _, section := range file.sections {
+		if kind, name, ok := configSectionKind(section.name); ok {
+			sections = append(sections, ConfigSection{Kind: kind, Name: name, Properties: section.properties()})
+		}
+	}
+	return sections, nil
+}
+
+// SaveConfigSection validates a section and writes it to the config file. If
+// original is set the section of that name is replaced where it is, keeping
+// its comments and the lines of settings that did not change. Otherwise the
+// section is added to the end of the file.
+func SaveConfigSection(original string, section ConfigSection) error {
+	if err := validateConfigSection(section); err != nil {
+		return err
+	}
+	file, err := readIniFile(ConfigFilePath())
+	if err != nil {
+		return err
+	}
+	credentialsFile, err := readIniFile(CredentialsFilePath())
+	if err != nil {
+		return err
+	}
+
+	var existing *iniSection
+	if original != "" {
+		var ok bool
+		if existing, ok = file.configSection(section.Kind, original); !ok {
+			return fmt.Errorf("%s %s no longer exists in %s", section.Kind, original, file.path)
+		}
+	}
+	if section.Name != original {
+		if _, exists := file.configSection(section.Kind, section.Name); exists {
+			return fmt.Errorf("%s %s already exists in %s", section.Kind, section.Name, file.path)
+		}
+		if original != "" {
+			if users := usersOf(buildProfiles(file, credentialsFile), section.Kind, original); len(users) > 0 {
+				return fmt.Errorf("%s %s cannot be renamed, it is used by %s", section.Kind, original, strings.Join(users, ", "))
+			}
+		}
+	}
+
+	if existing != nil {
+		if section.Name != original {
+			existing.header = iniLine{raw: "[" + section.sectionName() + "]"}
+			existing.name = section.sectionName()
+		}
+		existing.replaceProperties(section.Properties)
+	} else {
+		file.addSection(section.sectionName(), section.Properties)
+	}
+	if section.Kind == CONFIG_SECTION_PROFILE {
+		if err := validateReferences(buildProfiles(file, credentialsFile), section.Name); err != nil {
+			return err
+		}
+	}
+
+	if err := file.write(file.mode(CONFIG_FILE_MODE)); err != nil {
+		return err
+	}
+	slog.Info("Saved config section", "kind", section.Kind, "name", section.Name, "original", original, "file", file.path)
+	return nil
+}
+
+// DeleteConfigSection removes a profile or sso-session from the config file. It
+// fails if another profile refers to it.
+func DeleteConfigSection(kind string, name string) error {
+	file, err := readIniFile(ConfigFilePath())
+	if err != nil {
+		return err
+	}
+	credentialsFile, err := readIniFile(CredentialsFilePath())
+	if err != nil {
+		return err
+	}
+	section, ok := file.configSection(kind, name)
+	if !ok {
+		return fmt.Errorf("%s %s does not exist in %s", kind, name, file.path)
+	}
+	if users := usersOf(buildProfiles(file, credentialsFile), kind, name); len(users) > 0 {
+		return fmt.Errorf("%s %s cannot be deleted, it is used by %s", kind, name, strings.Join(users, ", "))
+	}
+	file.removeSection(section)
+	if err := file.write(file.mode(CONFIG_FILE_MODE)); err != nil {
+		return err
+	}
+	slog.Info("Deleted config section", "kind", kind, "name", name, "file", file.path)
+	return nil
+}
+
+// The profiles that use a profile as their source_profile, or an sso-session.
+func usersOf(profiles *Profiles, kind string, name string) []string {
+	users := make([]string, 0)
+	for _, profile := range profiles.Profiles {
+		switch {
+		case kind == CONFIG_SECTION_PROFILE && profile.SourceProfile == name && profile.Name != name:
+			users = append(users, profile.Name)
+		case kind == CONFIG_SECTION_SSO_SESSION && profile.SSOSession == name:
+			users = append(users, profile.Name)
+		}
+	}
+	return users
+}
+
+// Check the sso-session and source profiles a profile refers to exist.
+func validateReferences(profiles *Profiles, name string) error {
+	profile, ok := profiles.Get(name)
+	if !ok {
+		return nil
+	}
+	if profile.SSOSession != "" {
+		if _, ok := profiles.SSOSessions[profile.SSOSession]; !ok {
+			return fmt.Errorf("sso-session %s does not exist", profile.SSOSession)
+		}
+	}
+	if profile.SourceProfile == name && profile.AccessKeyID == "" {
+		return fmt.Errorf("profile %s is its own source_profile but has no access keys", name)
+	}
+	_, err := profiles.RoleChain(name)
+	return err
+}
+
+// Check the name and settings of a section on their own.
+func validateConfigSection(section ConfigSection) error {
+	if section.Kind != CONFIG_SECTION_PROFILE && section.Kind != CONFIG_SECTION_SSO_SESSION {
+		return fmt.Errorf("unknown kind of section %q", section.Kind)
+	}
+	if !sectionNamePattern.MatchString(section.Name) {
+		return fmt.Errorf("%q is not a valid name, it cannot be empty or contain spaces or brackets", section.Name)
+	}
+
+	settings := make(map[string]string)
+	for _, property := range section.Properties {
+		key, value := property[0], property[1]
+		if !keyPattern.MatchString(key) {
+			return fmt.Errorf("%q is not a valid setting name", key)
+		}
+		if _, duplicate := settings[key]; duplicate {
+			return fmt.Errorf("%s is set more than once", key)
+		}
+		settings[key] = value
+		if err := validateSetting(key, value); err != nil {
+			return err
+		}
+	}
+
+	has := func(key string) bool {
+		_, ok := settings[key]
+		return ok
+	}
+	if section.Kind == CONFIG_SECTION_SSO_SESSION {
+		if !has("sso_start_url") || !has("sso_region") {
+			return fmt.Errorf("an sso-session needs an sso_start_url and an sso_region")
+		}
+		return nil
+	}
+	switch {
+	case has("source_profile") && has("credential_source"):
+		return fmt.Errorf("source_profile and credential_source cannot both be set")
+	case has("role_arn") && !has("source_profile") && !has("credential_source") && !has("web_identity_token_file"):
+		return fmt.Errorf("role_arn needs a source_profile, credential_source or web_identity_token_file")
+	case has("sso_account_id") != has("sso_role_name"):
+		return fmt.Errorf("sso_account_id and sso_role_name must be set together")
+	case has("sso_start_url") && !has("sso_session") && !has("sso_region"):
+		return fmt.Errorf("sso_start_url needs an sso_region")
+	}
+	return nil
+}
+
+// Check the value of a setting canopy knows the format of.
+func validateSetting(key string, value string) error {
+	switch key {
+	case "region", "sso_region":
+		if !regionPattern.MatchString(value) {
+			return fmt.Errorf("%s %q is not a region, e.g. us-east-1", key, value)
+		}
+	case "sso_account_id":
+		if !accountIDPattern.MatchString(value) {
+			return fmt.Errorf("sso_account_id %q is not a 12 digit account ID", value)
+		}
+	case "role_arn":
+		if !roleARNPattern.MatchString(value) {
+			return fmt.Errorf("role_arn %q is not the ARN of an IAM role", value)
+		}
+	case "duration_seconds":
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < MIN_ROLE_DURATION_SECONDS || seconds > MAX_ROLE_DURATION_SECONDS {
+			return fmt.Errorf("duration_seconds must be a number from %d to %d", MIN_ROLE_DURATION_SECONDS, MAX_ROLE_DURATION_SECONDS)
+		}
+	case "credential_source":
+		if !slices.Contains(credentialSources, value) {
+			return fmt.Errorf("credential_source must be one of %s", strings.Join(credentialSources, ", "))
+		}
+	case "sso_start_url":
+		if parsed, err := url.Parse(value); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("sso_start_url %q is not an https URL", value)
+		}
+	case "source_profile", "sso_session", "web_identity_token_file", "credential_process":
+		if value == "" {
+			return fmt.Errorf("%s cannot be empty", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const editorConfig = `# Shared settings
+[default]
+region = us-east-1 # home region
+
+[profile base]
+# Long lived keys are in the credentials file
+region = eu-west-1
+cli_pager =
+
+[profile deploy]
+role_arn = arn:aws:iam::123456789012:role/Deploy
+source_profile = base
+
+[sso-session work]
+sso_start_url = https://work.awsapps.com/start
+sso_region = us-east-2
+
+[profile admin]
+sso_session = work
+sso_account_id = 123456789012
+sso_role_name = Admin
+
+[services local]
+s3 =
+  endpoint_url = http://localhost:4566
+`
+
+const editorCredentials = `[base]
+aws_access_key_id = AKIAEXAMPLE
+aws_secret_access_key = secret
+`
+
+// Point the config and credentials files at temporary copies of the test files.
+func useEditorFiles(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+	credentialsPath := filepath.Join(dir, "credentials")
+	if err := os.WriteFile(configPath, []byte(editorConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(credentialsPath, []byte(editorCredentials), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configPath)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsPath)
+	return configPath
+}
+
+func readConfig(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestValidateConfigSection(t *testing.T) {
+	profile := func(properties ...[2]string) ConfigSection {
+		return ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "dev", Properties: properties}
+	}
+	tests := []struct {
+		name    string
+		section ConfigSection
+		err     string // Expected error, empty if the section is valid
+	}{
+		{name: "valid static", section: profile([2]string{"region", "us-east-1"}, [2]string{"output", "json"})},
+		{name: "valid gov cloud region", section: profile([2]string{"region", "us-gov-west-1"})},
+		{name: "valid role", section: profile(
+			[2]string{"role_arn", "arn:aws:iam::123456789012:role/path/Deploy"},
+			[2]string{"source_profile", "base"},
+			[2]string{"duration_seconds", "3600"},
+		)},
+		{name: "valid sso-session", section: ConfigSection{Kind: CONFIG_SECTION_SSO_SESSION, Name: "work", Properties: [][2]string{
+			{"sso_start_url", "https://work.awsapps.com/start"},
+			{"sso_region", "us-east-2"},
+		}}},
+		{name: "unknown kind", section: ConfigSection{Kind: "services", Name: "dev"}, err: "unknown kind"},
+		{name: "name with a space", section: ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "my dev"}, err: "not a valid name"},
+		{name: "empty name", section: ConfigSection{Kind: CONFIG_SECTION_PROFILE}, err: "not a valid name"},
+		{name: "bad key", section: profile([2]string{"Region Name", "us-east-1"}), err: "not a valid setting name"},
+		{name: "duplicate key", section: profile([2]string{"region", "us-east-1"}, [2]string{"region", "us-west-2"}), err: "more than once"},
+		{name: "bad region", section: profile([2]string{"region", "US East"}), err: "is not a region"},
+		{name: "bad sso region", section: profile([2]string{"sso_region", "useast1"}), err: "is not a region"},
+		{name: "short account", section: profile(
+			[2]string{"sso_account_id", "12345"},
+			[2]string{"sso_role_name", "Admin"},
+		), err: "12 digit account ID"},
+		{name: "bad role arn", section: profile(
+			[2]string{"role_arn", "arn:aws:iam::123456789012:user/me"},
+			[2]string{"source_profile", "base"},
+		), err: "not the ARN of an IAM role"},
+		{name: "duration too short", section: profile([2]string{"duration_seconds", "60"}), err: "duration_seconds must be"},
+		{name: "duration too long", section: profile([2]string{"duration_seconds", "43201"}), err: "duration_seconds must be"},
+		{name: "duration not a number", section: profile([2]string{"duration_seconds", "1h"}), err: "duration_seconds must be"},
+		{name: "bad credential source", section: profile(
+			[2]string{"role_arn", "arn:aws:iam::123456789012:role/Deploy"},
+			[2]string{"credential_source", "Laptop"},
+		), err: "credential_source must be"},
+		{name: "http start url", section: profile([2]string{"sso_start_url", "http://work.awsapps.com/start"}, [2]string{"sso_region", "us-east-1"}), err: "not an https URL"},
+		{name: "empty source profile", section: profile([2]string{"source_profile", ""}), err: "cannot be empty"},
+		{name: "role without source", section: profile([2]string{"role_arn", "arn:aws:iam::123456789012:role/Deploy"}), err: "needs a source_profile"},
+		{name: "two sources", section: profile(
+			[2]string{"role_arn", "arn:aws:iam::123456789012:role/Deploy"},
+			[2]string{"source_profile", "base"},
+			[2]string{"credential_source", "Environment"},
+		), err: "cannot both be set"},
+		{name: "account without role", section: profile([2]string{"sso_account_id", "123456789012"}), err: "must be set together"},
+		{name: "start url without region", section: profile([2]string{"sso_start_url", "https://work.awsapps.com/start"}), err: "needs an sso_region"},
+		{name: "sso-session without region", section: ConfigSection{Kind: CONFIG_SECTION_SSO_SESSION, Name: "work", Properties: [][2]string{
+			{"sso_start_url", "https://work.awsapps.com/start"},
+		}}, err: "needs an sso_start_url and an sso_region"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateConfigSection(test.section)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("got error %v, want the section to be valid", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestSaveConfigSection(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		section  ConfigSection
+		err      string // Expected error, the file must be unchanged if set
+		want     string // The config file after the save
+	}{
+		{
+			name:     "edit keeps comments and other sections",
+			original: "base",
+			section: ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "base", Properties: [][2]string{
+				{"region", "us-west-2"},
+				{"cli_pager", ""},
+				{"output", "json"},
+			}},
+			want: strings.Replace(editorConfig, "region = eu-west-1\ncli_pager =\n", "region = us-west-2\ncli_pager =\noutput = json\n", 1),
+		},
+		{
+			name:     "edit removes a setting",
+			original: "default",
+			section:  ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "default", Properties: [][2]string{{"output", "text"}}},
+			want:     strings.Replace(editorConfig, "region = us-east-1 # home region\n", "output = text\n", 1),
+		},
+		{
+			name:     "rename a profile nothing uses",
+			original: "admin",
+			section: ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "administrator", Properties: [][2]string{
+				{"sso_session", "work"},
+				{"sso_account_id", "123456789012"},
+				{"sso_role_name", "Admin"},
+			}},
+			want: strings.Replace(editorConfig, "[profile admin]\n", "[profile administrator]\n", 1),
+		},
+		{
+			name: "new section is added at the end",
+			section: ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "reader", Properties: [][2]string{
+				{"role_arn", "arn:aws:iam::123456789012:role/Reader"},
+				{"source_profile", "deploy"},
+			}},
+			want: editorConfig + "\n[profile reader]\nrole_arn = arn:aws:iam::123456789012:role/Reader\nsource_profile = deploy\n",
+		},
+		{
+			name: "dangling source profile",
+			section: ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "reader", Properties: [][2]string{
+				{"role_arn", "arn:aws:iam::123456789012:role/Reader"},
+				{"source_profile", "missing"},
+			}},
+			err: "source profile missing does not exist",
+		},
+		{
+			name:     "source profile loop",
+			original: "base",
+			section: ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "base", Properties: [][2]string{
+				{"role_arn", "arn:aws:iam::123456789012:role/Base"},
+				{"source_profile", "deploy"},
+			}},
+			err: "is its own source profile",
+		},
+		{
+			name: "own source profile without keys",
+			section: ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "self", Properties: [][2]string{
+				{"role_arn", "arn:aws:iam::123456789012:role/Self"},
+				{"source_profile", "self"},
+			}},
+			err: "its own source_profile but has no access keys",
+		},
+		{
+			name: "dangling sso-session",
+			section: ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "viewer", Properties: [][2]string{
+				{"sso_session", "home"},
+				{"sso_account_id", "123456789012"},
+				{"sso_role_name", "ReadOnly"},
+			}},
+			err: "sso-session home does not exist",
+		},
+		{
+			name:     "rename onto an existing profile",
+			original: "admin",
+			section:  ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "deploy"},
+			err:      "profile deploy already exists",
+		},
+		{
+			name:    "new profile with an existing name",
+			section: ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "default"},
+			err:     "profile default already exists",
+		},
+		{
+			name:     "rename a profile used as a source",
+			original: "base",
+			section:  ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "root", Properties: [][2]string{{"region", "eu-west-1"}}},
+			err:      "cannot be renamed, it is used by deploy",
+		},
+		{
+			name:     "rename an sso-session in use",
+			original: "work",
+			section: ConfigSection{Kind: CONFIG_SECTION_SSO_SESSION, Name: "office", Properties: [][2]string{
+				{"sso_start_url", "https://work.awsapps.com/start"},
+				{"sso_region", "us-east-2"},
+			}},
+			err: "cannot be renamed, it is used by admin",
+		},
+		{
+			name:     "original no longer exists",
+			original: "gone",
+			section:  ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "gone"},
+			err:      "no longer exists",
+		},
+		{
+			name:     "invalid setting",
+			original: "base",
+			section:  ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "base", Properties: [][2]string{{"region", "Ireland"}}},
+			err:      "is not a region",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := useEditorFiles(t)
+			err := SaveConfigSection(test.original, test.section)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v, want one containing %q", err, test.err)
+				}
+				if got := readConfig(t, path); got != editorConfig {
+					t.Errorf("a rejected save changed the file:\n%s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("save failed: %v", err)
+			}
+			if got := readConfig(t, path); got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDeleteConfigSection(t *testing.T) {
+	tests := []struct {
+		name string
+		kind string
+		err  string
+		want string
+	}{
+		{
+			name: "admin",
+			kind: CONFIG_SECTION_PROFILE,
+			want: strings.Replace(editorConfig, "[profile admin]\nsso_session = work\nsso_account_id = 123456789012\nsso_role_name = Admin\n\n", "", 1),
+		},
+		{name: "base", kind: CONFIG_SECTION_PROFILE, err: "cannot be deleted, it is used by deploy"},
+		{name: "work", kind: CONFIG_SECTION_SSO_SESSION, err: "cannot be deleted, it is used by admin"},
+		{name: "missing", kind: CONFIG_SECTION_PROFILE, err: "does not exist"},
+	}
+	for _, test := range tests {
+		t.Run(test.kind+" "+test.name, func(t *testing.T) {
+			path := useEditorFiles(t)
+			err := DeleteConfigSection(test.kind, test.name)
+			want := test.want
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v, want one containing %q", err, test.err)
+				}
+				want = editorConfig
+			} else if err != nil {
+				t.Fatalf("delete failed: %v", err)
+			}
+			if got := readConfig(t, path); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSaveConfigSectionThroughSymlink(t *testing.T) {
+	link := useEditorFiles(t)
+	target := filepath.Join(t.TempDir(), "dotfiles", "aws-config")
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(link, target); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(target, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	section := ConfigSection{Kind: CONFIG_SECTION_PROFILE, Name: "default", Properties: [][2]string{{"region", "us-west-2"}}}
+	if err := SaveConfigSection("default", section); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatal("the symlink was replaced with a regular file")
+	}
+	if got := readConfig(t, target); !strings.Contains(got, "region = us-west-2") {
+		t.Errorf("the file the link points to was not updated:\n%s", got)
+	}
+	if info, err := os.Stat(target); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("got mode %v, %v, want the original 0640", info.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(target)); len(entries) != 1 {
+		t.Errorf("the dotfiles directory has %d files, want no temporary files left", len(entries))
+	}
+}
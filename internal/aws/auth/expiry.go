@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// When credentials expire, zero if they do not.
+func expiresAt(creds aws.Credentials) time.Time {
+	if !creds.CanExpire {
+		return time.Time{}
+	}
+	return creds.Expires
+}
+
+// CanRefresh reports whether new credentials can be had without the user, by
+// assuming the role again or running the credential_process. Roles whose chain
+// needs an MFA code cannot, the user would be asked for a code.
+func (c *AWSConfig) CanRefresh() bool {
+	if c.Previous != nil {
+		// A role assumed in canopy is assumed again with the credentials it was assumed from
+		return c.Previous.CanRefresh() || c.Previous.Expires.IsZero()
+	}
+	if c.Profile == nil {
+		return false
+	}
+	switch c.Profile.AuthType {
+	case AUTH_TYPE_ASSUME_ROLE, AUTH_TYPE_CREDENTIAL_PROCESS:
+		// An mfa_serial anywhere up the source_profile chain needs a code
+		profiles, err := LoadProfiles()
+		return err == nil && !requiresMFA(profiles, c.Profile.Name)
+	}
+	return false
+}
+
+// WithRegion returns a copy of the config that makes calls in another region
+// with the same credentials. The configs roles were assumed from move along so
+// stepping back keeps the region.
+func (c *AWSConfig) WithRegion(region string) *AWSConfig {
+	cfg := c.Config.Copy()
+	cfg.Region = region
+	moved := *c
+	moved.Config = &cfg
+	moved.Region = region
+	if c.Previous != nil {
+		moved.Previous = c.Previous.WithRegion(region)
+	}
+	return &moved
+}
+
+// Refresh gets new credentials before the current ones expire. The config is
+// not changed, a copy with the new expiry is returned.
+func (c *AWSConfig) Refresh(ctx context.Context) (*AWSConfig, error) {
+	if cache, ok := c.Config.Credentials.(*aws.CredentialsCache); ok {
+		cache.Invalidate() // Otherwise the cache hands out the current credentials until they expire
+	}
+	creds, err := RetrieveCredentials(ctx, c.Config)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Refreshed credentials", "identity", c.Identity(), "expires", creds.Expires)
+	refreshed := *c
+	refreshed.AccessKeyID = creds.AccessKeyID
+	refreshed.CredentialsSource = creds.Source
+	refreshed.Expires = expiresAt(creds)
+	return &refreshed, nil
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const refreshConfig = `[profile base]
+aws_access_key_id = AKIAEXAMPLE
+
+[profile mfa-base]
+aws_access_key_id = AKIAEXAMPLE
+mfa_serial = arn:aws:iam::123456789012:mfa/me
+
+[profile role]
+role_arn = arn:aws:iam::123456789012:role/Deploy
+source_profile = base
+
+[profile mfa-role]
+role_arn = arn:aws:iam::123456789012:role/Deploy
+source_profile = base
+mfa_serial = arn:aws:iam::123456789012:mfa/me
+
+[profile chained-mfa-role]
+role_arn = arn:aws:iam::123456789012:role/Reader
+source_profile = mfa-upstream
+
+[profile mfa-upstream]
+role_arn = arn:aws:iam::123456789012:role/Deploy
+source_profile = mfa-base
+
+[profile process]
+credential_process = /usr/local/bin/creds
+
+[profile sso]
+sso_start_url = https://work.awsapps.com/start
+sso_region = us-east-1
+sso_account_id = 123456789012
+sso_role_name = Admin
+`
+
+func TestCanRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(refreshConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", path)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	profiles, err := LoadProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		profile string
+		want    bool
+	}{
+		{profile: "role", want: true},
+		{profile: "process", want: true},
+		{profile: "mfa-role", want: false},
+		{profile: "chained-mfa-role", want: false}, // The mfa_serial is two profiles up the chain
+		{profile: "base", want: false},
+		{profile: "sso", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.profile, func(t *testing.T) {
+			profile, ok := profiles.Get(test.profile)
+			if !ok {
+				t.Fatalf("profile %s was not loaded", test.profile)
+			}
+			config := &AWSConfig{Profile: profile}
+			if got := config.CanRefresh(); got != test.want {
+				t.Errorf("CanRefresh() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A line of an AWS config or credentials file. Every line is kept as it was
+// read so a file can be written back without losing comments or formatting.
+type iniLine struct {
+	raw    string // The line as it is in the file
+	key    string // Lower cased key of a property, empty for blank lines, comments and nested properties
+	value  string // Value of a property with any inline comment removed
+	nested bool   // An indented property below a property with no value, e.g. the settings below "s3 ="
+}
+
+func (l iniLine) isBlankOrComment() bool {
+	trimmed := strings.TrimSpace(l.raw)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";")
+}
+
+// A [section] and every line up to the next one.
+type iniSection struct {
+	header iniLine
+	name   string // The text between the brackets, e.g. "profile dev"
+	lines  []iniLine
+}
+
+// Set a property, replacing the line it is on if it is already set.
+func (s *iniSection) set(key string, value string) {
+	for i := len(s.lines) - 1; i >= 0; i-- {
+		if s.lines[i].key == key {
+			s.lines[i] = iniLine{raw: key + " = " + value, key: key, value: value}
+			return
+		}
+	}
+	// Add it after the last property so blank lines and comments before the next section stay there
+	at := len(s.lines)
+	for at > 0 && s.lines[at-1].isBlankOrComment() {
+		at--
+	}
+	s.lines = append(s.lines[:at], append([]iniLine{{raw: key + " = " + value, key: key, value: value}}, s.lines[at:]...)...)
+}
+
+// Remove every line setting a property, along with any nested properties below it.
+func (s *iniSection) unset(key string) {
+	lines := s.lines[:0]
+	removing := false
+	for _, line := range s.lines {
+		if line.key == key || (removing && line.nested) {
+			removing = true
+			continue
+		}
+		removing = false
+		lines = append(lines, line)
+	}
+	s.lines = lines
+}
+
+// The properties of the section in the order they are first set, with the
+// value that wins if a key is set more than once. Nested properties are left out.
+func (s *iniSection) properties() [][2]string {
+	properties := make([][2]string, 0)
+	seen := make(map[string]bool)
+	for _, line := range s.lines {
+		if line.key == "" || seen[line.key] {
+			continue
+		}
+		seen[line.key] = true
+		value, _ := s.get(line.key)
+		properties = append(properties, [2]string{line.key, value})
+	}
+	return properties
+}
+
+// Replace the properties of the section. Lines of properties that are kept
+// stay where they are with their comments, removed ones are taken out and new
+// ones are added after the last property.
+func (s *iniSection) replaceProperties(properties [][2]string) {
+	keep := make(map[string]bool)
+	for _, property := range properties {
+		keep[property[0]] = true
+	}
+	for _, existing := range s.properties() {
+		if !keep[existing[0]] {
+			s.unset(existing[0])
+		}
+	}
+	for _, property := range properties {
+		if value, ok := s.get(property[0]); !ok || value != property[1] {
+			s.set(property[0], property[1])
+		}
+	}
+}
+
+// Get the value of a property. If a key is set more than once the last one wins.
+func (s *iniSection) get(key string) (string, bool) {
+	value, found := "", false
+	for _, line := range s.lines {
+		if line.key == key {
+			value, found = line.value, true
+		}
+	}
+	return value, found
+}
+
+// An AWS config or credentials file.
+type iniFile struct {
+	path     string
+	preamble []iniLine // Lines before the first section
+	sections []*iniSection
+}
+
+// Find a section by name.
+func (f *iniFile) section(name string) (*iniSection, bool) {
+	for _, section := range f.sections {
+		if section.name == name {
+			return section, true
+		}
+	}
+	return nil, false
+}
+
+// Remove a section. Comments above it are part of the section before it and are kept.
+func (f *iniFile) removeSection(section *iniSection) {
+	f.sections = slices.DeleteFunc(f.sections, func(s *iniSection) bool { return s == section })
+}
+
+// Add a section with the given properties to the end of the file.
+func (f *iniFile) addSection(name string, properties [][2]string) *iniSection {
+	section := &iniSection{
+		header: iniLine{raw: "[" + name + "]"},
+		name:   name,
+	}
+	for _, property := range properties {
+		section.lines = append(section.lines, iniLine{
+			raw:   property[0] + " = " + property[1],
+			key:   property[0],
+			value: property[1],
+		})
+	}
+	// Keep a blank line between the new section and the one before it
+	if last := f.lastLine(); last != nil && strings.TrimSpace(last.raw) != "" {
+		if len(f.sections) > 0 {
+			previous := f.sections[len(f.sections)-1]
+			previous.lines = append(previous.lines, iniLine{})
+		} else {
+			f.preamble = append(f.preamble, iniLine{})
+		}
+	}
+	f.sections = append(f.sections, section)
+	return section
+}
+
+func (f *iniFile) lastLine() *iniLine {
+	if len(f.sections) > 0 {
+		last := f.sections[len(f.sections)-1]
+		if len(last.lines) == 0 {
+			return &last.header
+		}
+		return &last.lines[len(last.lines)-1]
+	}
+	if len(f.preamble) > 0 {
+		return &f.preamble[len(f.preamble)-1]
+	}
+	return nil
+}
+
+// The file as text. Lines that were read are written back exactly as they were.
+func (f *iniFile) String() string {
+	var builder strings.Builder
+	for _, line := range f.preamble {
+		builder.WriteString(line.raw + "\n")
+	}
+	for _, section := range f.sections {
+		builder.WriteString(section.header.raw + "\n")
+		for _, line := range section.lines {
+			builder.WriteString(line.raw + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// The permissions of the file, or of the file it links to, or fallback if it does not exist yet.
+func (f *iniFile) mode(fallback os.FileMode) os.FileMode {
+	if info, err := os.Stat(f.path); err == nil {
+		return info.Mode().Perm()
+	}
+	return fallback
+}
+
+// Write the file back to its path with the given permissions. The file is
+// replaced in one step so the SDK never reads a partially written file. If
+// the path is a symlink, e.g. into a dotfiles repository, the file it points
+// to is replaced and the link is kept.
+func (f *iniFile) write(mode os.FileMode) error {
+	path, err := filepath.EvalSymlinks(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		path = f.path
+	} else if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.WriteString(f.String()); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(mode); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// Read and parse a file. A file that does not exist is returned empty.
+func readIniFile(path string) (*iniFile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &iniFile{path: path}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseIni(path, string(data)), nil
+}
+
+func parseIni(path string, data string) *iniFile {
+	file := &iniFile{path: path}
+	if data == "" {
+		return file // An empty file has no lines, not one blank line
+	}
+	var section *iniSection
+	nested := false // Set after a property with no value, indented lines below it are nested properties
+	for _, raw := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		raw = strings.TrimSuffix(raw, "\r")
+		trimmed := strings.TrimSpace(raw)
+		line := iniLine{raw: raw}
+
+		switch {
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			section = &iniSection{
+				header: line,
+				name:   strings.Join(strings.Fields(trimmed[1:len(trimmed)-1]), " "),
+			}
+			file.sections = append(file.sections, section)
+			nested = false
+			continue
+		case trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";"):
+			// Blank line or comment
+		case nested && raw != trimmed:
+			// Nested property, e.g. the settings below "s3 ="
+			line.nested = true
+		default:
+			key, value, ok := strings.Cut(trimmed, "=")
+			if ok {
+				line.key = strings.ToLower(strings.TrimSpace(key))
+				line.value = stripInlineComment(strings.TrimSpace(value))
+				nested = line.value == ""
+			}
+		}
+
+		if section == nil {
+			file.preamble = append(file.preamble, line)
+		} else {
+			section.lines = append(section.lines, line)
+		}
+	}
+	return file
+}
+
+// Remove a comment at the end of a value. It has to be preceded by whitespace
+// so values like URLs with a # in them are kept intact.
+func stripInlineComment(value string) string {
+	for i := 1; i < len(value); i++ {
+		if (value[i] == '#' || value[i] == ';') && (value[i-1] == ' ' || value[i-1] == '\t') {
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
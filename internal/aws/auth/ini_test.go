@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseIniRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "empty",
+			data: "",
+		},
+		{
+			name: "comments and blank lines",
+			data: "# Managed by hand\n\n[default]\nregion = us-east-1 # home\n; old setting\n\n\n[profile dev]\n  region=eu-west-1\n",
+		},
+		{
+			name: "unknown keys and sections keep their order",
+			data: "[services local]\ns3 =\n  endpoint_url = http://localhost:4566\n[profile dev]\nzzz_custom = 1\nregion = us-west-2\naaa_custom = 2\n[sso-session work]\nsso_start_url = https://example.awsapps.com/start#/\nsso_region = us-east-1\n",
+		},
+		{
+			name: "preamble before the first section",
+			data: "; global comment\nstray = value\n\n[default]\n",
+		},
+		{
+			name: "odd spacing and case",
+			data: "[ profile   spaced ]\nRegion   =   us-east-2\n\tOutput=json\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseIni("config", test.data).String(); got != test.data {
+				t.Errorf("round trip changed the file:\ngot:\n%q\nwant:\n%q", got, test.data)
+			}
+		})
+	}
+}
+
+func TestParseIniSections(t *testing.T) {
+	tests := []struct {
+		header string
+		name   string // Name of the parsed section
+		kind   string // Kind from configSectionKind, empty if it is not a profile or sso-session
+		short  string // Name from configSectionKind
+	}{
+		{header: "[default]", name: "default", kind: CONFIG_SECTION_PROFILE, short: "default"},
+		{header: "[profile dev]", name: "profile dev", kind: CONFIG_SECTION_PROFILE, short: "dev"},
+		{header: "[profile default]", name: "profile default", kind: CONFIG_SECTION_PROFILE, short: "default"},
+		{header: "[ profile  dev ]", name: "profile dev", kind: CONFIG_SECTION_PROFILE, short: "dev"},
+		{header: "[sso-session work]", name: "sso-session work", kind: CONFIG_SECTION_SSO_SESSION, short: "work"},
+		{header: "[dev]", name: "dev"},
+		{header: "[profile]", name: "profile"},
+		{header: "[services local]", name: "services local"},
+	}
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			file := parseIni("config", test.header+"\nregion = us-east-1\n")
+			if len(file.sections) != 1 || file.sections[0].name != test.name {
+				t.Fatalf("got sections %+v, want one named %q", file.sections, test.name)
+			}
+			kind, short, ok := configSectionKind(file.sections[0].name)
+			if ok != (test.kind != "") || kind != test.kind || short != test.short {
+				t.Errorf("got kind %q name %q (%v), want kind %q name %q", kind, short, ok, test.kind, test.short)
+			}
+			if value, _ := file.sections[0].get("region"); value != "us-east-1" {
+				t.Errorf("got region %q in the section, want us-east-1", value)
+			}
+		})
+	}
+}
+
+func TestParseIniProperties(t *testing.T) {
+	data := "[profile dev]\n" +
+		"Region = us-east-1 ; inline comment\n" +
+		"sso_start_url = https://example.awsapps.com/start#/\n" +
+		"s3 =\n" +
+		"  max_concurrent_requests = 10\n" +
+		"  addressing_style = path\n" +
+		"output = json\n" +
+		"region = eu-west-1\n" +
+		"  indented = not nested\n"
+	section := parseIni("config", data).sections[0]
+
+	tests := []struct {
+		key   string
+		value string
+		found bool
+	}{
+		{key: "region", value: "eu-west-1", found: true}, // The last one wins
+		{key: "sso_start_url", value: "https://example.awsapps.com/start#/", found: true},
+		{key: "s3", value: "", found: true},
+		{key: "output", value: "json", found: true},
+		{key: "indented", value: "not nested", found: true}, // Only lines below a key with no value are nested
+		{key: "max_concurrent_requests", found: false},
+		{key: "addressing_style", found: false},
+	}
+	for _, test := range tests {
+		value, found := section.get(test.key)
+		if value != test.value || found != test.found {
+			t.Errorf("get(%q) = %q, %v, want %q, %v", test.key, value, found, test.value, test.found)
+		}
+	}
+
+	want := [][2]string{
+		{"region", "eu-west-1"},
+		{"sso_start_url", "https://example.awsapps.com/start#/"},
+		{"s3", ""},
+		{"output", "json"},
+		{"indented", "not nested"},
+	}
+	if got := section.properties(); !slices.Equal(got, want) {
+		t.Errorf("got properties %v, want %v", got, want)
+	}
+
+	// Removing a key with nested properties removes them too
+	section.unset("s3")
+	file := &iniFile{sections: []*iniSection{section}}
+	wantFile := "[profile dev]\n" +
+		"Region = us-east-1 ; inline comment\n" +
+		"sso_start_url = https://example.awsapps.com/start#/\n" +
+		"output = json\n" +
+		"region = eu-west-1\n" +
+		"  indented = not nested\n"
+	if got := file.String(); got != wantFile {
+		t.Errorf("after unset got:\n%q\nwant:\n%q", got, wantFile)
+	}
+}
+
+func TestIniSectionEdits(t *testing.T) {
+	data := "# top\n[profile dev]\n# the region\nregion = us-east-1\noutput = json\n\n# next one\n[profile prod]\nregion = us-west-2\n"
+	tests := []struct {
+		name string
+		edit func(file *iniFile)
+		want string
+	}{
+		{
+			name: "set replaces the line in place",
+			edit: func(file *iniFile) {
+				section, _ := file.section("profile dev")
+				section.set("region", "eu-west-1")
+			},
+			want: "# top\n[profile dev]\n# the region\nregion = eu-west-1\noutput = json\n\n# next one\n[profile prod]\nregion = us-west-2\n",
+		},
+		{
+			name: "set adds new keys before trailing comments",
+			edit: func(file *iniFile) {
+				section, _ := file.section("profile dev")
+				section.set("mfa_serial", "arn:aws:iam::123456789012:mfa/me")
+			},
+			want: "# top\n[profile dev]\n# the region\nregion = us-east-1\noutput = json\nmfa_serial = arn:aws:iam::123456789012:mfa/me\n\n# next one\n[profile prod]\nregion = us-west-2\n",
+		},
+		{
+			name: "replace properties keeps unchanged lines",
+			edit: func(file *iniFile) {
+				section, _ := file.section("profile dev")
+				section.replaceProperties([][2]string{{"region", "us-east-1"}, {"cli_pager", ""}})
+			},
+			want: "# top\n[profile dev]\n# the region\nregion = us-east-1\ncli_pager = \n\n# next one\n[profile prod]\nregion = us-west-2\n",
+		},
+		{
+			name: "add section after a blank line",
+			edit: func(file *iniFile) {
+				file.addSection("sso-session work", [][2]string{{"sso_region", "us-east-1"}})
+			},
+			want: data + "\n[sso-session work]\nsso_region = us-east-1\n",
+		},
+		{
+			name: "remove section",
+			edit: func(file *iniFile) {
+				section, _ := file.section("profile prod")
+				file.removeSection(section)
+			},
+			want: "# top\n[profile dev]\n# the region\nregion = us-east-1\noutput = json\n\n# next one\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := parseIni("config", data)
+			test.edit(file)
+			if got := file.String(); got != test.want {
+				t.Errorf("got:\n%q\nwant:\n%q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+)
+
+// MFATokenFunc asks the user for the current code of the MFA device with the given serial.
+type MFATokenFunc func(ctx context.Context, serialNumber string) (string, error)
+
+// MFASessions supplies MFA codes to profiles with an mfa_serial and keeps
+// their credentials, so the code is only asked for again once they expire
+// instead of on every switch to the profile.
+type MFASessions struct {
+	tokenFunc MFATokenFunc
+	lock      sync.Mutex                         // Protects sessions
+	sessions  map[string]aws.CredentialsProvider // Credentials of MFA profiles by profile name
+}
+
+func NewMFASessions(tokenFunc MFATokenFunc) *MFASessions {
+	return &MFASessions{
+		tokenFunc: tokenFunc,
+		sessions:  make(map[string]aws.CredentialsProvider),
+	}
+}
+
+// A load option giving the SDK's assume role provider a way to ask for MFA codes.
+// The codes are asked for with ctx while it is alive, so cancelling the load
+// cancels the prompt. Refreshes after the load has finished are not bound to it.
+func (m *MFASessions) loadOption(ctx context.Context) config.LoadOptionsFunc {
+	return config.WithAssumeRoleCredentialOptions(func(options *stscreds.AssumeRoleOptions) {
+		serialNumber := aws.ToString(options.SerialNumber)
+		options.TokenProvider = func() (string, error) {
+			tokenCtx := ctx
+			if ctx.Err() != nil {
+				tokenCtx = context.WithoutCancel(ctx)
+			}
+			slog.InfoContext(tokenCtx, "Asking for MFA code", "serialNumber", serialNumber)
+			return m.tokenFunc(tokenCtx, serialNumber)
+		}
+	})
+}
+
+// The credentials to use for an MFA profile. The first provider given for a
+// profile is kept and returned for later loads, it only asks for a new code
+// once its credentials expire.
+func (m *MFASessions) session(profile string, provider aws.CredentialsProvider) aws.CredentialsProvider {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if cached, ok := m.sessions[profile]; ok {
+		slog.Debug("Reusing MFA session", "profile", profile)
+		return cached
+	}
+	m.sessions[profile] = provider
+	return provider
+}
+
+// Forget drops the cached session of a profile, e.g. after its credentials
+// could not be retrieved, so the next load starts a new one.
+func (m *MFASessions) Forget(profile string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.sessions, profile)
+}
+
+// Whether a profile or any profile it assumes a role from needs an MFA code.
+func requiresMFA(profiles *Profiles, name string) bool {
+	chain, _ := profiles.RoleChain(name)
+	for _, profile := range chain {
+		if profile.MFASerial != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	awsMiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Logs every AWS API call with the request id of the trigger that made it.
+type logAPICall struct{}
+
+func (logAPICall) ID() string {
+	return "CanopyLogAPICall"
+}
+
+func (logAPICall) HandleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	service := awsMiddleware.GetServiceID(ctx)
+	operation := awsMiddleware.GetOperationName(ctx)
+	start := time.Now()
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	awsRequestID, _ := awsMiddleware.GetRequestIDMetadata(metadata)
+	if err != nil {
+		slog.ErrorContext(ctx, "AWS API call failed", "service", service, "operation", operation, "awsRequestId", awsRequestID, "duration", time.Since(start), "error", err)
+	} else {
+		slog.DebugContext(ctx, "AWS API call", "service", service, "operation", operation, "awsRequestId", awsRequestID, "duration", time.Since(start))
+	}
+	return out, metadata, err
+}
+
+// apiOptions are added to every config canopy loads.
+var apiOptions = []func(*middleware.Stack) error{
+	func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(logAPICall{}, middleware.Before)
+	},
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// How a profile gets its credentials
+type AuthType string
+
+const (
+	AUTH_TYPE_STATIC             AuthType = "static"            // Access keys in the profile
+	AUTH_TYPE_SSO                AuthType = "sso"               // IAM Identity Center, with or without an sso-session
+	AUTH_TYPE_ASSUME_ROLE        AuthType = "assumeRole"        // role_arn with a source_profile or credential_source
+	AUTH_TYPE_WEB_IDENTITY       AuthType = "webIdentity"       // role_arn with a web_identity_token_file
+	AUTH_TYPE_CREDENTIAL_PROCESS AuthType = "credentialProcess" // An external command prints the credentials
+	AUTH_TYPE_NONE               AuthType = "none"              // Nothing in the profile, credentials come from the environment
+)
+
+// Profile is a profile from the AWS config and credentials files. Settings
+// from the credentials file take precedence over the config file.
+type Profile struct {
+	Name     string
+	AuthType AuthType
+	Region   string
+	Files    []string // The files the profile is defined in
+
+	// Static credentials. The secret is never kept.
+	AccessKeyID     string
+	HasSessionToken bool
+
+	// SSO
+	SSOSession   string // Name of the sso-session block, empty for legacy SSO profiles
+	SSOStartURL  string // From the sso-session block if the profile uses one
+	SSORegion    string // From the sso-session block if the profile uses one
+	SSOAccountID string
+	SSORoleName  string
+
+	// Assume role
+	RoleARN          string
+	SourceProfile    string
+	CredentialSource string
+	RoleSessionName  string
+	ExternalID       string
+	MFASerial        string
+	DurationSeconds  string
+
+	CredentialProcess    string
+	WebIdentityTokenFile string
+}
+
+// SSOSession is an [sso-session] block shared by SSO profiles.
+type SSOSession struct {
+	Name               string
+	StartURL           string
+	Region             string
+	RegistrationScopes string
+}
+
+// Key identifies the session in the SSO token cache: its name, or the start
+// URL for the stand-in sessions of legacy SSO profiles.
+func (s *SSOSession) Key() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.StartURL
+}
+
+// Scopes returns the registration scopes, empty if they are not set.
+func (s *SSOSession) Scopes() []string {
+	scopes := make([]string, 0)
+	for _, scope := range strings.Split(s.RegistrationScopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// Profiles holds every profile and sso-session from the AWS config and credentials files.
+type Profiles struct {
+	Profiles    []*Profile // In the order they appear, config file first
+	SSOSessions map[string]*SSOSession
+	byName      map[string]*Profile
+}
+
+// Get a profile by name.
+func (p *Profiles) Get(name string) (*Profile, bool) {
+	profile, ok := p.byName[name]
+	return profile, ok
+}
+
+// RoleChain returns the profile followed by every source_profile it assumes a
+// role from, ending with the profile that has the base credentials.
+func (p *Profiles) RoleChain(name string) ([]*Profile, error) {
+	chain := make([]*Profile, 0)
+	seen := make(map[string]bool)
+	for name != "" {
+		profile, ok := p.Get(name)
+		if !ok {
+			return chain, fmt.Errorf("source profile %s does not exist", name)
+		}
+		if seen[name] {
+			return chain, fmt.Errorf("profile %s is its own source profile", name)
+		}
+		seen[name] = true
+		chain = append(chain, profile)
+		if profile.RoleARN == "" || profile.SourceProfile == name {
+			// A profile can assume a role with its own static credentials
+			break
+		}
+		name = profile.SourceProfile
+	}
+	return chain, nil
+}
+
+// SSOLogins lists everything that can be logged in to with SSO: every
+// sso-session sorted by name, followed by a stand-in session without a name
+// for each start URL legacy SSO profiles log in to on their own.
+func (p *Profiles) SSOLogins() []*SSOSession {
+	logins := make([]*SSOSession, 0, len(p.SSOSessions))
+	for _, session := range p.SSOSessions {
+		logins = append(logins, session)
+	}
+	sort.Slice(logins, func(i, j int) bool { return logins[i].Name < logins[j].Name })
+	seen := make(map[string]bool)
+	for _, profile := range p.Profiles {
+		if profile.AuthType != AUTH_TYPE_SSO || profile.SSOSession != "" || seen[profile.SSOStartURL] {
+			continue
+		}
+		seen[profile.SSOStartURL] = true
+		logins = append(logins, &SSOSession{StartURL: profile.SSOStartURL, Region: profile.SSORegion})
+	}
+	return logins
+}
+
+// SSOLogin finds a login from SSOLogins by its key.
+func (p *Profiles) SSOLogin(key string) (*SSOSession, bool) {
+	for _, login := range p.SSOLogins() {
+		if login.Key() == key {
+			return login, true
+		}
+	}
+	return nil, false
+}
+
+// ConfigFilePath returns the path of the AWS config file.
+func ConfigFilePath() string {
+	if path := os.Getenv("AWS_CONFIG_FILE"); path != "" {
+		return path
+	}
+	return config.DefaultSharedConfigFilename()
+}
+
+// CredentialsFilePath returns the path of the AWS credentials file.
+func CredentialsFilePath() string {
+	if path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); path != "" {
+		return path
+	}
+	return config.DefaultSharedCredentialsFilename()
+}
+
+// LoadProfiles reads the AWS config and credentials files. Files that do not exist are skipped.
+func LoadProfiles() (*Profiles, error) {
+	configFile, err := readIniFile(ConfigFilePath())
+	if err != nil {
+		return nil, err
+	}
+	credentialsFile, err := readIniFile(CredentialsFilePath())
+	if err != nil {
+		return nil, err
+	}
+	return buildProfiles(configFile, credentialsFile), nil
+}
+
+func buildProfiles(configFile *iniFile, credentialsFile *iniFile) *Profiles {
+	profiles := &Profiles{
+		Profiles:    make([]*Profile, 0),
+		SSOSessions: make(map[string]*SSOSession),
+		byName:      make(map[string]*Profile),
+	}
+	for _, section := range configFile.sections {
+		kind, name, ok := configSectionKind(section.name)
+		switch {
+		case ok && kind == CONFIG_SECTION_SSO_SESSION:
+			profiles.SSOSessions[name] = newSSOSession(name, section)
+		case ok && kind == CONFIG_SECTION_PROFILE:
+			profiles.profile(name).apply(section, configFile.path)
+		}
+	}
+	// Every section of the credentials file is a profile, without a prefix
+	for _, section := range credentialsFile.sections {
+		if section.name != "" {
+			profiles.profile(section.name).apply(section, credentialsFile.path)
+		}
+	}
+
+	for _, profile := range profiles.Profiles {
+		if session, ok := profiles.SSOSessions[profile.SSOSession]; ok {
+			profile.SSOStartURL = session.StartURL
+			profile.SSORegion = session.Region
+		}
+		profile.AuthType = profile.classify()
+	}
+	return profiles
+}
+
+// Get a profile, adding it if it has not been seen yet.
+func (p *Profiles) profile(name string) *Profile {
+	if profile, ok := p.byName[name]; ok {
+		return profile
+	}
+	profile := &Profile{Name: name, Files: make([]string, 0)}
+	p.byName[name] = profile
+	p.Profiles = append(p.Profiles, profile)
+	return profile
+}
+
+// Split a section name like "profile dev" into its kind and name.
+func splitSectionName(section string) (string, string) {
+	kind, name, ok := strings.Cut(section, " ")
+	if !ok {
+		return "", section
+	}
+	return kind, strings.TrimSpace(name)
+}
+
+func newSSOSession(name string, section *iniSection) *SSOSession {
+	session := &SSOSession{Name: name}
+	setFrom(section, "sso_start_url", &session.StartURL)
+	setFrom(section, "sso_region", &session.Region)
+	setFrom(section, "sso_registration_scopes", &session.RegistrationScopes)
+	return session
+}
+
+// Set the profile's settings from a section, keeping what is not set in it.
+func (p *Profile) apply(section *iniSection, path string) {
+	p.Files = append(p.Files, path)
+	setFrom(section, "region", &p.Region)
+	setFrom(section, "aws_access_key_id", &p.AccessKeyID)
+	if token, ok := section.get("aws_session_token"); ok && token != "" {
+		p.HasSessionToken = true
+	}
+	setFrom(section, "sso_session", &p.SSOSession)
+	setFrom(section, "sso_start_url", &p.SSOStartURL)
+	setFrom(section, "sso_region", &p.SSORegion)
+	setFrom(section, "sso_account_id", &p.SSOAccountID)
+	setFrom(section, "sso_role_name", &p.SSORoleName)
+	setFrom(section, "role_arn", &p.RoleARN)
+	setFrom(section, "source_profile", &p.SourceProfile)
+	setFrom(section, "credential_source", &p.CredentialSource)
+	setFrom(section, "role_session_name", &p.RoleSessionName)
+	setFrom(section, "external_id", &p.ExternalID)
+	setFrom(section, "mfa_serial", &p.MFASerial)
+	setFrom(section, "duration_seconds", &p.DurationSeconds)
+	setFrom(section, "credential_process", &p.CredentialProcess)
+	setFrom(section, "web_identity_token_file", &p.WebIdentityTokenFile)
+}
+
+func setFrom(section *iniSection, key string, target *string) {
+	if value, ok := section.get(key); ok {
+		*target = value
+	}
+}
+
+// Work out how the SDK will get credentials for the profile, in the same
+// order it checks the settings: source_profile, static keys,
+// credential_source, web identity, SSO and then credential_process.
+func (p *Profile) classify() AuthType {
+	switch {
+	case p.RoleARN != "" && p.SourceProfile != "":
+		return AUTH_TYPE_ASSUME_ROLE
+	case p.AccessKeyID != "":
+		return AUTH_TYPE_STATIC
+	case p.RoleARN != "" && p.CredentialSource != "":
+		return AUTH_TYPE_ASSUME_ROLE
+	case p.RoleARN != "" && p.WebIdentityTokenFile != "":
+		return AUTH_TYPE_WEB_IDENTITY
+	case p.SSOSession != "" || p.SSOStartURL != "":
+		return AUTH_TYPE_SSO
+	case p.CredentialProcess != "":
+		return AUTH_TYPE_CREDENTIAL_PROCESS
+	default:
+		return AUTH_TYPE_NONE
+	}
+}
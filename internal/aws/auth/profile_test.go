@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+)
+
+const testConfig = `[default]
+region = us-east-1
+
+[profile keys]
+aws_access_key_id = AKIAEXAMPLE
+
+[profile sso]
+sso_session = work
+sso_account_id = 123456789012
+sso_role_name = Admin
+
+[profile legacy-sso]
+sso_start_url = https://legacy.awsapps.com/start
+sso_region = eu-west-1
+sso_account_id = 123456789012
+sso_role_name = ReadOnly
+
+[profile role]
+role_arn = arn:aws:iam::123456789012:role/Deploy
+source_profile = keys
+
+[profile instance-role]
+role_arn = arn:aws:iam::123456789012:role/Deploy
+credential_source = Ec2InstanceMetadata
+
+[profile web]
+role_arn = arn:aws:iam::123456789012:role/Web
+web_identity_token_file = /var/run/token
+
+[profile web-with-keys]
+role_arn = arn:aws:iam::123456789012:role/Web
+web_identity_token_file = /var/run/token
+aws_access_key_id = AKIAEXAMPLE
+
+[profile process]
+credential_process = /usr/local/bin/creds
+
+[profile dangling-role]
+role_arn = arn:aws:iam::123456789012:role/Deploy
+
+[sso-session work]
+sso_start_url = https://work.awsapps.com/start
+sso_region = us-east-2
+
+[dev]
+region = us-west-1
+`
+
+const testCredentials = `[keys]
+aws_access_key_id = AKIAOVERRIDE
+aws_secret_access_key = secret
+
+[process]
+aws_access_key_id = AKIAFROMCREDENTIALS
+aws_secret_access_key = secret
+aws_session_token = token
+
+[only-credentials]
+aws_access_key_id = AKIAONLY
+aws_secret_access_key = secret
+`
+
+func TestBuildProfilesClassifies(t *testing.T) {
+	profiles := buildProfiles(parseIni("config", testConfig), parseIni("credentials", testCredentials))
+
+	tests := []struct {
+		name     string
+		authType AuthType
+		files    []string
+	}{
+		{name: "default", authType: AUTH_TYPE_NONE, files: []string{"config"}},
+		{name: "keys", authType: AUTH_TYPE_STATIC, files: []string{"config", "credentials"}},
+		{name: "sso", authType: AUTH_TYPE_SSO, files: []string{"config"}},
+		{name: "legacy-sso", authType: AUTH_TYPE_SSO, files: []string{"config"}},
+		{name: "role", authType: AUTH_TYPE_ASSUME_ROLE, files: []string{"config"}},
+		{name: "instance-role", authType: AUTH_TYPE_ASSUME_ROLE, files: []string{"config"}},
+		{name: "web", authType: AUTH_TYPE_WEB_IDENTITY, files: []string{"config"}},
+		// The SDK uses static keys before a web identity token
+		{name: "web-with-keys", authType: AUTH_TYPE_STATIC, files: []string{"config"}},
+		// Keys in the credentials file are used before the credential process
+		{name: "process", authType: AUTH_TYPE_STATIC, files: []string{"config", "credentials"}},
+		{name: "dangling-role", authType: AUTH_TYPE_NONE, files: []string{"config"}},
+		{name: "only-credentials", authType: AUTH_TYPE_STATIC, files: []string{"credentials"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile, ok := profiles.Get(test.name)
+			if !ok {
+				t.Fatalf("profile %s was not loaded", test.name)
+			}
+			if profile.AuthType != test.authType {
+				t.Errorf("got auth type %s, want %s", profile.AuthType, test.authType)
+			}
+			if !slices.Equal(profile.Files, test.files) {
+				t.Errorf("got files %v, want %v", profile.Files, test.files)
+			}
+		})
+	}
+
+	// [dev] in the config file is not a profile, it needs the profile prefix there
+	if _, ok := profiles.Get("dev"); ok {
+		t.Error("[dev] in the config file was loaded as a profile")
+	}
+	names := make([]string, 0)
+	for _, profile := range profiles.Profiles {
+		names = append(names, profile.Name)
+	}
+	want := []string{"default", "keys", "sso", "legacy-sso", "role", "instance-role", "web", "web-with-keys", "process", "dangling-role", "only-credentials"}
+	if !slices.Equal(names, want) {
+		t.Errorf("got profiles in order %v, want %v", names, want)
+	}
+}
+
+func TestBuildProfilesSettings(t *testing.T) {
+	profiles := buildProfiles(parseIni("config", testConfig), parseIni("credentials", testCredentials))
+
+	keys, _ := profiles.Get("keys")
+	if keys.AccessKeyID != "AKIAOVERRIDE" || keys.HasSessionToken {
+		t.Errorf("got keys %s with session token %v, want the credentials file to win", keys.AccessKeyID, keys.HasSessionToken)
+	}
+	process, _ := profiles.Get("process")
+	if !process.HasSessionToken || process.CredentialProcess != "/usr/local/bin/creds" {
+		t.Errorf("got %+v, want the settings of both files", process)
+	}
+
+	// SSO profiles get the start URL and region of their sso-session
+	sso, _ := profiles.Get("sso")
+	if sso.SSOStartURL != "https://work.awsapps.com/start" || sso.SSORegion != "us-east-2" {
+		t.Errorf("got start URL %q and region %q, want the ones of sso-session work", sso.SSOStartURL, sso.SSORegion)
+	}
+	logins := profiles.SSOLogins()
+	if len(logins) != 2 || logins[0].Key() != "work" || logins[1].Key() != "https://legacy.awsapps.com/start" {
+		t.Errorf("got SSO logins %+v, want sso-session work and the legacy start URL", logins)
+	}
+
+	chain, err := profiles.RoleChain("role")
+	if err != nil || len(chain) != 2 || chain[1].Name != "keys" {
+		t.Errorf("got role chain %v, %v, want role then keys", chain, err)
+	}
+}
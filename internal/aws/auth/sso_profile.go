@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// Mode of a config file canopy creates
+const CONFIG_FILE_MODE = 0600
+
+// AddSSOProfile writes a profile for a role of an SSO account to the end of the
+// config file. It fails if a profile with the name already exists.
+func AddSSOProfile(name string, session *SSOSession, accountID string, roleName string, region string) error {
+	file, err := readIniFile(ConfigFilePath())
+	if err != nil {
+		return err
+	}
+	if _, exists := file.configSection(CONFIG_SECTION_PROFILE, name); exists {
+		return fmt.Errorf("profile %s already exists in %s", name, file.path)
+	}
+
+	properties := make([][2]string, 0)
+	if session.Name != "" {
+		properties = append(properties, [2]string{"sso_session", session.Name})
+	} else {
+		// Legacy profiles carry the start URL themselves
+		properties = append(properties,
+			[2]string{"sso_start_url", session.StartURL},
+			[2]string{"sso_region", session.Region})
+	}
+	properties = append(properties,
+		[2]string{"sso_account_id", accountID},
+		[2]string{"sso_role_name", roleName})
+	if region != "" {
+		properties = append(properties, [2]string{"region", region})
+	}
+	file.addSection(configSectionName(CONFIG_SECTION_PROFILE, name), properties)
+	if err := file.write(file.mode(CONFIG_FILE_MODE)); err != nil {
+		return err
+	}
+	slog.Info("Added SSO profile", "profile", name, "file", file.path)
+	return nil
+}
+
+// GetAwsConfigFromSSORole creates a config for a role of an SSO account that
+// no profile points at. The credentials are retrieved with GetRoleCredentials
+// by the given provider.
+func GetAwsConfigFromSSORole(ctx context.Context, credentials aws.CredentialsProvider, accountID string, roleName string, region string) (*AWSConfig, error) {
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithCredentialsProvider(aws.NewCredentialsCache(credentials)),
+		config.WithDefaultRegion(region),
+		config.WithAPIOptions(apiOptions))
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load config for SSO role", "error", err)
+		return nil, err
+	}
+
+	creds, err := RetrieveCredentials(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Using SSO role", "accountId", accountID, "role", roleName)
+
+	configData := ipc.AWSConfigData{
+		Profile:           "",
+		AuthType:          string(AUTH_TYPE_SSO),
+		SSORoleName:       roleName,
+		AccountId:         accountID,
+		AssumeRoleARN:     "",
+		AccessKeyID:       creds.AccessKeyID,
+		CredentialsSource: creds.Source,
+		Expires:           expiresAt(creds),
+		Region:            cfg.Region,
+	}
+
+	return &AWSConfig{
+		AWSConfigData: configData,
+		Config:        &cfg,
+		Profile:       nil, // The role is not from a profile
+	}, nil
+}
@@ -0,0 +1,92 @@
+package regions
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Directory in the user's config directory canopy keeps its state in
+const STATE_DIR = "canopy"
+
+// File in STATE_DIR with the last region used with each profile
+const REGIONS_FILE = "regions.json"
+
+var memoryLock sync.Mutex // Serializes reading and writing REGIONS_FILE
+
+func memoryPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, STATE_DIR, REGIONS_FILE), nil
+}
+
+// Read the remembered regions by profile. A file that does not exist is empty.
+func readMemory(path string) (map[string]string, error) {
+	remembered := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return remembered, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &remembered); err != nil {
+		return nil, err
+	}
+	return remembered, nil
+}
+
+// Remembered returns the region last used with a profile, empty if there is none.
+func Remembered(profile string) string {
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+	path, err := memoryPath()
+	if err != nil {
+		return ""
+	}
+	remembered, err := readMemory(path)
+	if err != nil {
+		return ""
+	}
+	return remembered[profile]
+}
+
+// Remember saves the region last used with a profile.
+func Remember(profile string, region string) error {
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+	path, err := memoryPath()
+	if err != nil {
+		return err
+	}
+	remembered, err := readMemory(path)
+	if err != nil {
+		remembered = make(map[string]string) // Start over rather than never remembering again
+	}
+	remembered[profile] = region
+	data, err := json.MarshalIndent(remembered, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Replace the file in one step so a crash never leaves half of it
+	temp, err := os.CreateTemp(filepath.Dir(path), REGIONS_FILE+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,84 @@
+package regions
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// Region DescribeRegions is called in when the config has none
+const DEFAULT_REGION = "us-east-1"
+
+// Opt in status of a region the account had to enable
+const OPTED_IN = "opted-in"
+
+// Region is a region the account can use.
+type Region struct {
+	Name  string
+	OptIn bool // The region is disabled by default and was enabled for the account
+}
+
+// Regions offered when the enabled regions cannot be listed, e.g. offline or
+// without ec2:DescribeRegions. Opt in regions are included since canopy cannot
+// tell which ones the account has enabled.
+var fallbackRegions = []Region{
+	{Name: "af-south-1", OptIn: true},
+	{Name: "ap-east-1", OptIn: true},
+	{Name: "ap-northeast-1"},
+	{Name: "ap-northeast-2"},
+	{Name: "ap-northeast-3"},
+	{Name: "ap-south-1"},
+	{Name: "ap-south-2", OptIn: true},
+	{Name: "ap-southeast-1"},
+	{Name: "ap-southeast-2"},
+	{Name: "ap-southeast-3", OptIn: true},
+	{Name: "ap-southeast-4", OptIn: true},
+	{Name: "ap-southeast-5", OptIn: true},
+	{Name: "ap-southeast-7", OptIn: true},
+	{Name: "ca-central-1"},
+	{Name: "ca-west-1", OptIn: true},
+	{Name: "eu-central-1"},
+	{Name: "eu-central-2", OptIn: true},
+	{Name: "eu-north-1"},
+	{Name: "eu-south-1", OptIn: true},
+	{Name: "eu-south-2", OptIn: true},
+	{Name: "eu-west-1"},
+	{Name: "eu-west-2"},
+	{Name: "eu-west-3"},
+	{Name: "il-central-1", OptIn: true},
+	{Name: "me-central-1", OptIn: true},
+	{Name: "me-south-1", OptIn: true},
+	{Name: "mx-central-1", OptIn: true},
+	{Name: "sa-east-1"},
+	{Name: "us-east-1"},
+	{Name: "us-east-2"},
+	{Name: "us-west-1"},
+	{Name: "us-west-2"},
+}
+
+// Fallback returns the regions to offer when List fails.
+func Fallback() []Region {
+	return append([]Region(nil), fallbackRegions...)
+}
+
+// List returns the regions enabled for the account of cfg, sorted by name.
+func List(ctx context.Context, cfg aws.Config) ([]Region, error) {
+	if cfg.Region == "" {
+		cfg.Region = DEFAULT_REGION
+	}
+	output, err := ec2.NewFromConfig(cfg).DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, err
+	}
+	regions := make([]Region, 0, len(output.Regions))
+	for _, region := range output.Regions {
+		regions = append(regions, Region{
+			Name:  aws.ToString(region.RegionName),
+			OptIn: aws.ToString(region.OptInStatus) == OPTED_IN,
+		})
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Name < regions[j].Name })
+	return regions, nil
+}
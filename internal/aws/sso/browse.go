@@ -0,0 +1,119 @@
+package sso
+
+import (
+	"context"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+)
+
+// Environment variable overriding the SSO portal endpoint, the same one the SDK and the aws CLI read
+const PORTAL_ENDPOINT_ENV = "AWS_ENDPOINT_URL_SSO"
+
+// Account is an AWS account the SSO session has access to.
+type Account struct {
+	AccountID string
+	Name      string
+	Email     string
+}
+
+// The token provider reading the session's token from the SSO cache. It
+// refreshes an expired token if the login got a refresh token.
+func tokenProvider(settings LoginSettings) (*ssocreds.SSOTokenProvider, error) {
+	cache, err := newTokenCache(settings)
+	if err != nil {
+		return nil, err
+	}
+	return ssocreds.NewSSOTokenProvider(newClient(settings), cache.path), nil
+}
+
+// The access token of the session from the SSO cache.
+func accessToken(ctx context.Context, settings LoginSettings) (string, error) {
+	provider, err := tokenProvider(settings)
+	if err != nil {
+		return "", err
+	}
+	token, err := provider.RetrieveBearerToken(ctx)
+	if err != nil {
+		return "", &SSOLoginError{Message: "The SSO session has expired or is invalid, log in again"}
+	}
+	return token.Value, nil
+}
+
+func newPortalClient(settings LoginSettings) *sso.Client {
+	endpoint := os.Getenv(PORTAL_ENDPOINT_ENV)
+	return sso.New(sso.Options{
+		Region:      settings.Region,
+		Credentials: aws.AnonymousCredentials{}, // The portal is authorized with the access token
+	}, func(options *sso.Options) {
+		if endpoint != "" {
+			options.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+}
+
+// ListAccounts lists every account the session has access to, sorted by name.
+func ListAccounts(ctx context.Context, settings LoginSettings) ([]Account, error) {
+	token, err := accessToken(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]Account, 0)
+	paginator := sso.NewListAccountsPaginator(newPortalClient(settings), &sso.ListAccountsInput{
+		AccessToken: aws.String(token),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, account := range page.AccountList {
+			accounts = append(accounts, Account{
+				AccountID: aws.ToString(account.AccountId),
+				Name:      aws.ToString(account.AccountName),
+				Email:     aws.ToString(account.EmailAddress),
+			})
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+	return accounts, nil
+}
+
+// ListAccountRoles lists the roles the session can use in an account, sorted by name.
+func ListAccountRoles(ctx context.Context, settings LoginSettings, accountID string) ([]string, error) {
+	token, err := accessToken(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]string, 0)
+	paginator := sso.NewListAccountRolesPaginator(newPortalClient(settings), &sso.ListAccountRolesInput{
+		AccessToken: aws.String(token),
+		AccountId:   aws.String(accountID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range page.RoleList {
+			roles = append(roles, aws.ToString(role.RoleName))
+		}
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+// RoleCredentials returns a provider getting the credentials of a role with
+// GetRoleCredentials, using the session's token from the SSO cache.
+func RoleCredentials(settings LoginSettings, accountID string, roleName string) (aws.CredentialsProvider, error) {
+	provider, err := tokenProvider(settings)
+	if err != nil {
+		return nil, err
+	}
+	return ssocreds.New(newPortalClient(settings), accountID, roleName, settings.StartURL, func(options *ssocreds.Options) {
+		options.SSOTokenProvider = provider
+	}), nil
+}
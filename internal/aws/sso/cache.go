@@ -0,0 +1,91 @@
+package sso
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+)
+
+// A client registration that expires sooner than this is replaced instead of reused
+const REGISTRATION_MIN_LIFETIME = time.Hour
+
+// tokenCache is a token file in ~/.aws/sso/cache, in the format the aws CLI
+// writes. The file is named after the sso-session, or the start URL for
+// legacy profiles, so the SDK and the CLI read the token canopy writes.
+type tokenCache struct {
+	path                  string
+	StartURL              string `json:"startUrl"`
+	Region                string `json:"region"`
+	AccessToken           string `json:"accessToken"`
+	ExpiresAt             string `json:"expiresAt"`
+	ClientID              string `json:"clientId,omitempty"`
+	ClientSecret          string `json:"clientSecret,omitempty"`
+	RegistrationExpiresAt string `json:"registrationExpiresAt,omitempty"`
+	RefreshToken          string `json:"refreshToken,omitempty"`
+}
+
+// The cache file for the settings, with the registration of a previous login if there is one.
+func newTokenCache(settings LoginSettings) (*tokenCache, error) {
+	key := settings.SessionName
+	if key == "" {
+		key = settings.StartURL
+	}
+	path, err := ssocreds.StandardCachedTokenFilepath(key)
+	if err != nil {
+		return nil, &SSOLoginError{Message: "Failed to find the SSO token cache: " + err.Error()}
+	}
+	cache := &tokenCache{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, cache); err != nil || cache.StartURL != settings.StartURL {
+			cache = &tokenCache{} // Unreadable or for another start URL, start over
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, &SSOLoginError{Message: "Failed to read the SSO token cache: " + err.Error()}
+	}
+	cache.path = path
+	cache.StartURL = settings.StartURL
+	cache.Region = settings.Region
+	return cache, nil
+}
+
+func (c *tokenCache) registrationValid() bool {
+	if c.ClientID == "" || c.ClientSecret == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, c.RegistrationExpiresAt)
+	return err == nil && time.Until(expiresAt) > REGISTRATION_MIN_LIFETIME
+}
+
+// Write the cache file, readable only by the user like the CLI does.
+func (c *tokenCache) write() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	// Write to a temporary file first so a reader never sees a partial token
+	temp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), c.path)
+}
+
+// Times are written like the CLI does, in UTC without fractional seconds.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -1,10 +1,35 @@
 package sso
 
 import (
-	"bytes"
-	"os/exec"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
 )
 
+// Name canopy registers itself with as an OIDC client
+const CLIENT_NAME = "canopy"
+
+// Scope requested when an sso-session does not set sso_registration_scopes
+const DEFAULT_REGISTRATION_SCOPE = "sso:account:access"
+
+// Grant type of the OAuth device authorization flow
+const DEVICE_CODE_GRANT_TYPE = "urn:ietf:params:oauth:grant-type:device_code"
+
+// How often to poll for the token if the authorization does not say
+const DEFAULT_POLL_INTERVAL = 5 * time.Second
+
+// How much to slow down polling when the OIDC endpoint asks to
+const SLOW_DOWN_INCREMENT = 5 * time.Second
+
+// Environment variable overriding the OIDC endpoint, the same one the SDK and the aws CLI read
+const ENDPOINT_ENV = "AWS_ENDPOINT_URL_SSO_OIDC"
+
 type SSOLoginError struct {
 	Message string
 }
@@ -13,24 +38,147 @@ func (e *SSOLoginError) Error() string {
 	return e.Message
 }
 
-func ExecAwsSSOLogin(profile string) error {
-	cmd := exec.Command("aws", "sso", "login", "--profile", profile)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+// LoginSettings describes what to log in to. They come from an sso-session
+// block, or from the profile itself for legacy SSO profiles.
+type LoginSettings struct {
+	SessionName string   // Name of the sso-session, empty for legacy SSO profiles
+	StartURL    string   // The IAM Identity Center start URL
+	Region      string   // Region of IAM Identity Center
+	Scopes      []string // Registration scopes, only used with an sso-session
+}
+
+// DeviceAuthorization is what the user has to do in a browser to approve the login.
+type DeviceAuthorization struct {
+	VerificationURI         string // Page to enter the user code on
+	VerificationURIComplete string // Same page with the user code filled in
+	UserCode                string
+	ExpiresAt               time.Time // When the user code stops working
+}
 
-	err := cmd.Run()
-	stderrData := string(stderr.Bytes())
+// Login runs the OIDC device authorization flow: canopy registers itself as a
+// client, starts a device authorization which authorize is called with, and
+// polls until the user has approved it in their browser. The token is written
+// to the SSO cache where the SDK and the aws CLI pick it up.
+func Login(ctx context.Context, settings LoginSettings, authorize func(DeviceAuthorization)) error {
+	if settings.StartURL == "" || settings.Region == "" {
+		return &SSOLoginError{Message: "The SSO start URL and region must both be set"}
+	}
+	if settings.SessionName != "" && len(settings.Scopes) == 0 {
+		settings.Scopes = []string{DEFAULT_REGISTRATION_SCOPE}
+	}
+	if settings.SessionName == "" {
+		settings.Scopes = nil // Legacy profiles get no refresh token, the CLI does not ask for scopes either
+	}
+	client := newClient(settings)
+	cache, err := newTokenCache(settings)
 	if err != nil {
-		return &SSOLoginError{
-			Message: "Failed to execute aws sso login command: " + err.Error() + "\n" + stderrData,
-		}
+		return err
 	}
 
-	if cmd.ProcessState.ExitCode() != 0 {
-		return &SSOLoginError{
-			Message: "AWS SSO login command failed with exit code " + string(cmd.ProcessState.ExitCode()) + "\n" + stderrData,
-		}
+	registration, err := register(ctx, client, settings, cache)
+	if err != nil {
+		return err
+	}
+
+	started, err := client.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     aws.String(registration.ClientID),
+		ClientSecret: aws.String(registration.ClientSecret),
+		StartUrl:     aws.String(settings.StartURL),
+	})
+	if err != nil {
+		return &SSOLoginError{Message: "Failed to start the device authorization: " + err.Error()}
 	}
+	authorize(DeviceAuthorization{
+		VerificationURI:         aws.ToString(started.VerificationUri),
+		VerificationURIComplete: aws.ToString(started.VerificationUriComplete),
+		UserCode:                aws.ToString(started.UserCode),
+		ExpiresAt:               time.Now().Add(time.Duration(started.ExpiresIn) * time.Second),
+	})
 
+	interval := time.Duration(started.Interval) * time.Second
+	if interval <= 0 {
+		interval = DEFAULT_POLL_INTERVAL
+	}
+	token, err := pollToken(ctx, client, registration, aws.ToString(started.DeviceCode), interval)
+	if err != nil {
+		return err
+	}
+
+	cache.AccessToken = aws.ToString(token.AccessToken)
+	cache.ExpiresAt = formatTime(time.Now().Add(time.Duration(token.ExpiresIn) * time.Second))
+	cache.RefreshToken = aws.ToString(token.RefreshToken)
+	if err := cache.write(); err != nil {
+		return &SSOLoginError{Message: "Failed to write the SSO token cache: " + err.Error()}
+	}
+	slog.InfoContext(ctx, "SSO login finished", "startUrl", settings.StartURL, "session", settings.SessionName, "cache", cache.path)
 	return nil
 }
+
+func newClient(settings LoginSettings) *ssooidc.Client {
+	endpoint := os.Getenv(ENDPOINT_ENV)
+	return ssooidc.New(ssooidc.Options{
+		Region:      settings.Region,
+		Credentials: aws.AnonymousCredentials{}, // The OIDC operations are not signed
+	}, func(options *ssooidc.Options) {
+		if endpoint != "" {
+			options.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+}
+
+// Register canopy as an OIDC client, reusing the registration from the cache if it is still valid.
+func register(ctx context.Context, client *ssooidc.Client, settings LoginSettings, cache *tokenCache) (*tokenCache, error) {
+	if cache.registrationValid() {
+		slog.DebugContext(ctx, "Reusing cached OIDC client registration", "clientId", cache.ClientID)
+		return cache, nil
+	}
+	registered, err := client.RegisterClient(ctx, &ssooidc.RegisterClientInput{
+		ClientName: aws.String(CLIENT_NAME),
+		ClientType: aws.String("public"),
+		Scopes:     settings.Scopes,
+	})
+	if err != nil {
+		return nil, &SSOLoginError{Message: "Failed to register with IAM Identity Center: " + err.Error()}
+	}
+	cache.ClientID = aws.ToString(registered.ClientId)
+	cache.ClientSecret = aws.ToString(registered.ClientSecret)
+	cache.RegistrationExpiresAt = formatTime(time.Unix(registered.ClientSecretExpiresAt, 0))
+	return cache, nil
+}
+
+// Poll for the token until the user approves the authorization, denies it or it expires.
+func pollToken(ctx context.Context, client *ssooidc.Client, registration *tokenCache, deviceCode string, interval time.Duration) (*ssooidc.CreateTokenOutput, error) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		token, err := client.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     aws.String(registration.ClientID),
+			ClientSecret: aws.String(registration.ClientSecret),
+			DeviceCode:   aws.String(deviceCode),
+			GrantType:    aws.String(DEVICE_CODE_GRANT_TYPE),
+		})
+		var pending *types.AuthorizationPendingException
+		var slowDown *types.SlowDownException
+		var expired *types.ExpiredTokenException
+		var denied *types.AccessDeniedException
+		switch {
+		case err == nil:
+			return token, nil
+		case errors.As(err, &pending):
+		case errors.As(err, &slowDown):
+			interval += SLOW_DOWN_INCREMENT
+		case errors.As(err, &expired):
+			return nil, &SSOLoginError{Message: "The login was not approved before the code expired"}
+		case errors.As(err, &denied):
+			return nil, &SSOLoginError{Message: "The login was denied"}
+		default:
+			return nil, &SSOLoginError{Message: "Failed to get the SSO token: " + err.Error()}
+		}
+		timer.Reset(interval)
+	}
+}
@@ -0,0 +1,235 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+)
+
+// A response of the stand-in OIDC endpoint to CreateToken, an error type or a token.
+type tokenResponse struct {
+	errorType string // e.g. AuthorizationPendingException, empty for a token
+}
+
+// oidcStub stands in for the IAM Identity Center OIDC endpoint. CreateToken
+// answers with the responses in order, the last one is repeated.
+type oidcStub struct {
+	lock      sync.Mutex
+	responses []tokenResponse
+	polls     []time.Time // When CreateToken was called
+	registers int
+}
+
+func (o *oidcStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/client/register":
+		o.registers++
+		json.NewEncoder(w).Encode(map[string]any{
+			"clientId":              "client-id",
+			"clientSecret":          "client-secret",
+			"clientIdIssuedAt":      time.Now().Unix(),
+			"clientSecretExpiresAt": time.Now().Add(90 * 24 * time.Hour).Unix(),
+		})
+	case "/device_authorization":
+		json.NewEncoder(w).Encode(map[string]any{
+			"deviceCode":              "device-code",
+			"userCode":                "ABCD-EFGH",
+			"verificationUri":         "https://device.sso.example.com/",
+			"verificationUriComplete": "https://device.sso.example.com/?user_code=ABCD-EFGH",
+			"expiresIn":               600,
+			"interval":                1,
+		})
+	case "/token":
+		o.polls = append(o.polls, time.Now())
+		response := o.responses[min(len(o.polls), len(o.responses))-1]
+		if response.errorType != "" {
+			w.Header().Set("X-Amzn-Errortype", response.errorType)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"error": response.errorType})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"accessToken":  "access-token",
+			"refreshToken": "refresh-token",
+			"tokenType":    "Bearer",
+			"expiresIn":    3600,
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (o *oidcStub) pollCount() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.polls)
+}
+
+// Point the OIDC client at a stub and the SSO cache at a temporary home.
+func startStub(t *testing.T, responses ...tokenResponse) *oidcStub {
+	t.Helper()
+	stub := &oidcStub{responses: responses}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	t.Setenv(ENDPOINT_ENV, server.URL)
+	t.Setenv("HOME", t.TempDir())
+	return stub
+}
+
+var testSettings = LoginSettings{
+	SessionName: "work",
+	StartURL:    "https://example.awsapps.com/start",
+	Region:      "us-east-1",
+}
+
+func TestPollToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []tokenResponse
+		polls     int
+		err       string // Expected error, empty if a token is expected
+	}{
+		{
+			name:      "approved after pending",
+			responses: []tokenResponse{{"AuthorizationPendingException"}, {"AuthorizationPendingException"}, {}},
+			polls:     3,
+		},
+		{
+			name:      "expired",
+			responses: []tokenResponse{{"AuthorizationPendingException"}, {"ExpiredTokenException"}},
+			polls:     2,
+			err:       "not approved before the code expired",
+		},
+		{
+			name:      "denied",
+			responses: []tokenResponse{{"AccessDeniedException"}},
+			polls:     1,
+			err:       "denied",
+		},
+		{
+			name:      "unexpected error",
+			responses: []tokenResponse{{"InvalidGrantException"}},
+			polls:     1,
+			err:       "Failed to get the SSO token",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := startStub(t, test.responses...)
+			registration := &tokenCache{ClientID: "client-id", ClientSecret: "client-secret"}
+			token, err := pollToken(context.Background(), newClient(testSettings), registration, "device-code", 10*time.Millisecond)
+
+			if test.err == "" {
+				if err != nil || token == nil || *token.AccessToken != "access-token" {
+					t.Fatalf("got token %v and error %v, want the access token", token, err)
+				}
+			} else {
+				var loginErr *SSOLoginError
+				if !errors.As(err, &loginErr) || !strings.Contains(loginErr.Message, test.err) {
+					t.Fatalf("got error %v, want an SSOLoginError containing %q", err, test.err)
+				}
+			}
+			if stub.pollCount() != test.polls {
+				t.Errorf("polled %d times, want %d", stub.pollCount(), test.polls)
+			}
+		})
+	}
+}
+
+func TestPollTokenSlowsDown(t *testing.T) {
+	stub := startStub(t, tokenResponse{"SlowDownException"}, tokenResponse{})
+	registration := &tokenCache{ClientID: "client-id", ClientSecret: "client-secret"}
+
+	// The next poll is SLOW_DOWN_INCREMENT later, after the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), SLOW_DOWN_INCREMENT/2)
+	defer cancel()
+	_, err := pollToken(ctx, newClient(testSettings), registration, "device-code", 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want the deadline to pass while slowed down", err)
+	}
+	if stub.pollCount() != 1 {
+		t.Errorf("polled %d times after slow_down, want 1", stub.pollCount())
+	}
+}
+
+func TestLoginWritesTokenCache(t *testing.T) {
+	stub := startStub(t, tokenResponse{})
+	var authorization DeviceAuthorization
+	if err := Login(context.Background(), testSettings, func(a DeviceAuthorization) { authorization = a }); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if authorization.UserCode != "ABCD-EFGH" || authorization.VerificationURIComplete == "" || time.Until(authorization.ExpiresAt) <= 0 {
+		t.Errorf("got authorization %+v, want the one the endpoint started", authorization)
+	}
+
+	// The file the SDK and the aws CLI read for the sso-session
+	path, err := ssocreds.StandardCachedTokenFilepath(testSettings.SessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(path, os.Getenv("HOME")) {
+		t.Fatalf("cache file %s is outside the test home", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("token cache was not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("token cache has mode %v, want 0600", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("cache directory has %d files, want only the token", len(entries))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cache map[string]string
+	if err := json.Unmarshal(data, &cache); err != nil {
+		t.Fatalf("token cache is not a JSON object of strings: %v", err)
+	}
+	for key, want := range map[string]string{
+		"startUrl":     testSettings.StartURL,
+		"region":       testSettings.Region,
+		"accessToken":  "access-token",
+		"refreshToken": "refresh-token",
+		"clientId":     "client-id",
+		"clientSecret": "client-secret",
+	} {
+		if cache[key] != want {
+			t.Errorf("%s is %q, want %q", key, cache[key], want)
+		}
+	}
+	for _, key := range []string{"expiresAt", "registrationExpiresAt"} {
+		expiresAt, err := time.Parse(time.RFC3339, cache[key])
+		if err != nil || !strings.HasSuffix(cache[key], "Z") || strings.Contains(cache[key], ".") {
+			t.Errorf("%s is %q, want an RFC 3339 UTC time without fractional seconds", key, cache[key])
+		} else if !expiresAt.After(time.Now()) {
+			t.Errorf("%s is %q, want a time in the future", key, cache[key])
+		}
+	}
+
+	// A second login reuses the registration from the cache
+	if err := Login(context.Background(), testSettings, func(DeviceAuthorization) {}); err != nil {
+		t.Fatalf("second login failed: %v", err)
+	}
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+	if stub.registers != 1 {
+		t.Errorf("registered %d times, want the registration to be reused", stub.registers)
+	}
+}
@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"log/slog"
+
+	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+func (s *Server) registerAccessKeysHandlers() {
+	s.Handle(ipc.COMPONENT_SET_ACCESS_KEYS, ipc.ACTION_SET_ACCESS_KEYS, s.handleSetAccessKeys, s.mutating)
+}
+
+// Switch to access keys the user entered, after checking them with STS. The
+// keys are saved as a profile first if the user asked for it.
+func (s *Server) handleSetAccessKeys(trigger ipc.Trigger) {
+	keysData, err := ipc.Handle[ipc.AWSAccessKeysData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	region := keysData.Region
+	if current, _ := s.getConfig(); region == "" && current != nil {
+		region = current.Region
+	}
+
+	trigger.Progress("Validating access keys...")
+	config, err := awsAuth.GetAwsFromAccessKeys(trigger.Context, keysData.AccessKeyID, keysData.SecretAccessKey, keysData.SessionToken, region)
+	if err != nil {
+		accessKeysInvalid(err.Error(), trigger)
+		return
+	}
+
+	if keysData.SaveAsProfile != "" {
+		err = awsAuth.SaveAccessKeysProfile(keysData.SaveAsProfile, keysData.AccessKeyID, keysData.SecretAccessKey, keysData.SessionToken, region)
+		if err != nil {
+			accessKeysInvalid("The keys are valid but could not be saved: "+err.Error(), trigger)
+			return
+		}
+		// Use the saved profile rather than the bare keys so the header shows its name
+		trigger.Progress("Loading profile " + keysData.SaveAsProfile + "...")
+		config, err = s.refreshAwsConfig(trigger.Context, keysData.SaveAsProfile, region)
+		if err != nil {
+			accessKeysInvalid("The keys were saved but the profile could not be loaded: "+err.Error(), trigger)
+			return
+		}
+	} else {
+		s.setConfig(config)
+	}
+	slog.InfoContext(trigger.Context, "Switched to access keys", "accessKeyId", config.AccessKeyID, "profile", keysData.SaveAsProfile)
+
+	events := []ipc.Event{authChangedEvent(config)}
+	if keysData.SaveAsProfile != "" {
+		events = append(events, profilesChangedEvent())
+	}
+	trigger.Respond(append(events, ipc.Event{
+		Component: ipc.COMPONENT_SET_ACCESS_KEYS,
+		Action:    ipc.ACTION_SET_ACCESS_KEYS,
+		Data:      nil,
+	})...)
+}
+
+// Tell the view why the keys were not used. The message is shown in the view
+// itself so the user can correct the keys without retyping them.
+func accessKeysInvalid(message string, trigger ipc.Trigger) {
+	if trigger.Context.Err() != nil {
+		triggerErrorMessage(message, trigger) // Reports the cancellation
+		return
+	}
+	slog.WarnContext(trigger.Context, "Access keys were not used", "error", message)
+	trigger.Respond(ipc.Event{
+		Component: ipc.COMPONENT_SET_ACCESS_KEYS,
+		Action:    ipc.ACTION_ACCESS_KEYS_INVALID,
+		Data:      ipc.ErrorData{Message: message},
+	})
+}
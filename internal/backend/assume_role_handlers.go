@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"log/slog"
+	"time"
+
+	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+func (s *Server) registerAssumeRoleHandlers() {
+	s.Handle(ipc.COMPONENT_ASSUME_ROLE, ipc.ACTION_ASSUME_ROLE, s.handleAssumeRole, s.requireCredentials, s.mutating)
+	s.Handle(ipc.COMPONENT_ASSUME_ROLE, ipc.ACTION_STEP_BACK_ROLE, s.handleStepBackRole, s.requireCredentials, s.mutating)
+}
+
+func (s *Server) handleAssumeRole(trigger ipc.Trigger) {
+	roleData, err := ipc.Handle[ipc.AssumeRoleData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	source, _ := s.getConfig()
+	trigger.Progress("Assuming " + roleData.RoleARN + "...")
+	config, err := awsAuth.AssumeRole(trigger.Context, source, awsAuth.AssumeRoleInput{
+		RoleARN:     roleData.RoleARN,
+		SessionName: roleData.SessionName,
+		Duration:    time.Duration(roleData.DurationSeconds) * time.Second,
+		ExternalID:  roleData.ExternalID,
+	})
+	if err != nil {
+		triggerErrorMessage("Failed to assume role: "+err.Error(), trigger)
+		return
+	}
+	s.setConfig(config)
+	slog.InfoContext(trigger.Context, "Assumed role", "arn", config.AssumeRoleARN, "chain", config.RoleChain)
+
+	trigger.Respond(authChangedEvent(config), ipc.Event{
+		Component: ipc.COMPONENT_ASSUME_ROLE,
+		Action:    ipc.ACTION_ASSUME_ROLE,
+		Data:      nil,
+	})
+}
+
+// Go back to the identity the current role was assumed from.
+func (s *Server) handleStepBackRole(trigger ipc.Trigger) {
+	current, _ := s.getConfig()
+	if current == nil || current.Previous == nil {
+		triggerErrorMessage("No role has been assumed, there is nothing to step back to", trigger)
+		return
+	}
+	previous := current.Previous
+	s.setConfig(previous)
+	slog.InfoContext(trigger.Context, "Stepped back from assumed role", "from", current.Identity(), "to", previous.Identity())
+
+	trigger.Respond(authChangedEvent(previous), ipc.Event{
+		Component: ipc.COMPONENT_ASSUME_ROLE,
+		Action:    ipc.ACTION_STEP_BACK_ROLE,
+		Data:      nil,
+	})
+}
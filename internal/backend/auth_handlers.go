@@ -0,0 +1,43 @@
+package backend
+
+import (
+	"log/slog"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+func (s *Server) registerAuthHandlers() {
+	s.Handle(ipc.COMPONENT_HEADER, ipc.ACTION_GET_AUTH_DATA, s.handleGetAuthData, s.dedupe.middleware, s.requireCredentials)
+	s.Handle(ipc.COMPONENT_CHANGE_PROFILE, ipc.ACTION_CHANGE_PROFILE, s.handleChangeProfile, s.mutating)
+}
+
+func (s *Server) handleGetAuthData(trigger ipc.Trigger) {
+	config, _ := s.getConfig()
+	trigger.Respond(authChangedEvent(config))
+}
+
+func (s *Server) handleChangeProfile(trigger ipc.Trigger) {
+	profileData, err := ipc.Handle[ipc.ChangeProfileData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	current := ""
+	if config, _ := s.getConfig(); config != nil {
+		current = config.Region
+	}
+	region := regionFor(profileData.Profile, current)
+	trigger.Progress("Loading credentials for " + profileData.Profile + "...")
+	config, err := s.refreshAwsConfig(trigger.Context, profileData.Profile, region)
+	if err != nil {
+		triggerErrorMessage("Failed to refresh AWS configuration: "+err.Error(), trigger)
+		return
+	}
+	slog.InfoContext(trigger.Context, "Switched AWS profile", "profile", profileData.Profile)
+
+	trigger.Respond(authChangedEvent(config), ipc.Event{
+		Component: ipc.COMPONENT_CHANGE_PROFILE,
+		Action:    ipc.ACTION_CHANGE_PROFILE,
+		Data:      nil,
+	})
+}
@@ -0,0 +1,130 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
+	"github.com/livinlefevreloca/canopy/internal/credserver"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+func (s *Server) registerCredentialsServerHandlers() {
+	s.Handle(ipc.COMPONENT_CREDENTIALS_SERVER, ipc.ACTION_GET_CREDENTIALS_SERVER, s.handleGetCredentialsServer)
+	s.Handle(ipc.COMPONENT_CREDENTIALS_SERVER, ipc.ACTION_TOGGLE_CREDENTIALS_SERVER, s.handleToggleCredentialsServer)
+}
+
+// StartCredentialsServer serves the credentials of the current config on a
+// localhost endpoint. The endpoint reads the config on every request, so it
+// serves whatever identity is active after a profile switch. If it is already
+// running the running one is returned.
+func (s *Server) StartCredentialsServer(address string) (*credserver.Server, error) {
+	s.credsLock.Lock()
+	defer s.credsLock.Unlock()
+	return s.startCredentialsServer(address)
+}
+
+func (s *Server) stopCredentialsServer() {
+	s.credsLock.Lock()
+	defer s.credsLock.Unlock()
+	s.closeCredentialsServer()
+}
+
+// Start the endpoint if it is stopped, stop it if it is running.
+func (s *Server) toggleCredentialsServer(address string) error {
+	s.credsLock.Lock()
+	defer s.credsLock.Unlock()
+	if s.credentials != nil {
+		s.closeCredentialsServer()
+		return nil
+	}
+	_, err := s.startCredentialsServer(address)
+	return err
+}
+
+// Must be called with credsLock held.
+func (s *Server) startCredentialsServer(address string) (*credserver.Server, error) {
+	if s.credentials != nil {
+		return s.credentials, nil
+	}
+	server, err := credserver.Listen(address, s.currentCredentials)
+	if err != nil {
+		return nil, err
+	}
+	s.credentials = server
+	go func() {
+		if err := server.Serve(); err != nil {
+			slog.Error("Credentials endpoint failed", "error", err)
+		}
+	}()
+	return server, nil
+}
+
+// Must be called with credsLock held.
+func (s *Server) closeCredentialsServer() {
+	if s.credentials == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := s.credentials.Close(ctx); err != nil {
+		slog.Warn("Credentials endpoint did not stop cleanly", "error", err)
+	}
+	s.credentials = nil
+}
+
+// The credentials the endpoint serves.
+func (s *Server) currentCredentials(ctx context.Context) (aws.Credentials, error) {
+	config, ssoExpired := s.getConfig()
+	if ssoExpired {
+		return aws.Credentials{}, errors.New("the SSO session has expired, reauthenticate in canopy")
+	}
+	if config == nil {
+		return aws.Credentials{}, errors.New("no credentials are loaded in canopy")
+	}
+	return awsAuth.RetrieveCredentials(ctx, config.Config)
+}
+
+func (s *Server) credentialsServerData() ipc.CredentialsServerData {
+	s.credsLock.Lock()
+	defer s.credsLock.Unlock()
+	if s.credentials == nil {
+		return ipc.CredentialsServerData{Running: false}
+	}
+	return ipc.CredentialsServerData{
+		Running: true,
+		URL:     s.credentials.URL(),
+		Token:   s.credentials.Token(),
+	}
+}
+
+func (s *Server) handleGetCredentialsServer(trigger ipc.Trigger) {
+	trigger.Respond(ipc.Event{
+		Component: ipc.COMPONENT_CREDENTIALS_SERVER,
+		Action:    ipc.ACTION_GET_CREDENTIALS_SERVER,
+		Data:      s.credentialsServerData(),
+	})
+}
+
+// Stopping the endpoint is always allowed, starting it needs credentials to serve.
+func (s *Server) handleToggleCredentialsServer(trigger ipc.Trigger) {
+	if running := s.credentialsServerData().Running; !running {
+		s.requireCredentials(s.toggleCredentialsServerHandler)(trigger)
+		return
+	}
+	s.toggleCredentialsServerHandler(trigger)
+}
+
+func (s *Server) toggleCredentialsServerHandler(trigger ipc.Trigger) {
+	if err := s.toggleCredentialsServer(credserver.DEFAULT_ADDRESS); err != nil {
+		triggerErrorMessage("Failed to start the credentials endpoint: "+err.Error(), trigger)
+		return
+	}
+	trigger.Respond(ipc.Event{
+		Component: ipc.COMPONENT_CREDENTIALS_SERVER,
+		Action:    ipc.ACTION_TOGGLE_CREDENTIALS_SERVER,
+		Data:      s.credentialsServerData(),
+	})
+}
@@ -0,0 +1,180 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// A request being handled on behalf of every identical trigger that arrived
+// while it was in flight.
+type call struct {
+	lock      sync.Mutex
+	requestID string             // Request id of the trigger the handler runs for
+	batches   [][]ipc.Event      // Every batch sent so far, replayed to triggers that join late
+	updated   chan struct{}      // Closed and replaced whenever a batch is added or the call finishes
+	finished  bool               // Set once the handler returned
+	waiters   int                // Number of triggers still waiting for the result
+	cancel    context.CancelFunc // Cancels the handler once nobody is waiting
+}
+
+// deduplicator runs the handler once for identical Component/Action/payload
+// triggers that arrive while one of them is in flight for the same identity.
+// Every trigger gets every batch the handler sends. Only attach it to handlers
+// that do not change state, a repeated request that does must run again.
+type deduplicator struct {
+	lock     sync.Mutex // Protects calls
+	calls    map[string]*call
+	identity func() string // The identity requests are answered for, a switch starts new calls
+}
+
+func newDeduplicator(identity func() string) *deduplicator {
+	return &deduplicator{calls: make(map[string]*call), identity: identity}
+}
+
+// middleware shares the result of an in flight handler with identical triggers.
+func (d *deduplicator) middleware(next HandlerFunc) HandlerFunc {
+	return func(trigger ipc.Trigger) {
+		key, ok := d.requestKey(trigger)
+		if !ok {
+			next(trigger)
+			return
+		}
+		c, shared, started := d.join(key, trigger)
+		if !started {
+			d.wait(key, c, trigger)
+			return
+		}
+
+		// The handler runs on the worker of the trigger that started the call,
+		// so it counts against the dispatcher's limit and shutdown waits for it
+		// even if that trigger is cancelled while others are still waiting.
+		relayed := make(chan struct{})
+		go func() {
+			defer close(relayed)
+			d.wait(key, c, trigger)
+		}()
+		go d.collect(key, c, shared)
+		defer func() { <-relayed }()
+		defer shared.Close() // Also if the handler panics, so the relay finishes
+		next(shared)
+	}
+}
+
+// Identifies identical requests of the current identity, a request made after
+// switching must not get the answer for the previous one. Returns false if the
+// payload can not be encoded.
+func (d *deduplicator) requestKey(trigger ipc.Trigger) (string, bool) {
+	event := trigger.Event
+	payload, err := json.Marshal(event.Data)
+	if err != nil {
+		slog.WarnContext(trigger.Context, "Not deduplicating trigger with a payload that can not be encoded", "component", event.Component, "action", event.Action, "error", err)
+		return "", false
+	}
+	return d.identity() + "/" + event.Component + "/" + event.Action + "/" + string(payload), true
+}
+
+// Join the in flight call for the key or start a new one. If a new one is
+// started it returns the trigger the handler has to be run with.
+func (d *deduplicator) join(key string, trigger ipc.Trigger) (*call, ipc.Trigger, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if c, ok := d.calls[key]; ok {
+		c.lock.Lock()
+		c.waiters++
+		c.lock.Unlock()
+		slog.InfoContext(trigger.Context, "Joined in flight request", "component", trigger.Component, "action", trigger.Action, "sharedRequestId", c.requestID)
+		return c, ipc.Trigger{}, false
+	}
+
+	// The handler must outlive the trigger that started it if others are
+	// still waiting, so it only keeps the deadline of that trigger.
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := trigger.Context.Deadline(); ok {
+		ctx, cancel = context.WithDeadline(context.WithoutCancel(trigger.Context), deadline)
+	} else {
+		ctx, cancel = context.WithCancel(context.WithoutCancel(trigger.Context))
+	}
+	c := &call{
+		requestID: trigger.RequestID,
+		updated:   make(chan struct{}),
+		waiters:   1,
+		cancel:    cancel,
+	}
+	d.calls[key] = c
+
+	return c, ipc.NewTrigger(ctx, trigger.Event), true
+}
+
+// Keep every batch the handler sends until it is done.
+func (d *deduplicator) collect(key string, c *call, shared ipc.Trigger) {
+	for events := range shared.Responder {
+		c.lock.Lock()
+		c.batches = append(c.batches, events)
+		close(c.updated)
+		c.updated = make(chan struct{})
+		c.lock.Unlock()
+	}
+	d.remove(key, c)
+	c.lock.Lock()
+	c.finished = true
+	close(c.updated)
+	c.lock.Unlock()
+	c.cancel() // Release the context
+}
+
+// Send every batch of the call to the trigger until the call finishes or the trigger is cancelled.
+func (d *deduplicator) wait(key string, c *call, trigger ipc.Trigger) {
+	sent := 0
+	for {
+		c.lock.Lock()
+		batches := c.batches[sent:]
+		finished := c.finished
+		updated := c.updated
+		c.lock.Unlock()
+
+		for _, events := range batches {
+			trigger.Respond(events...) // Tagged with this trigger's request id
+		}
+		sent += len(batches)
+		if finished {
+			return
+		}
+
+		select {
+		case <-updated:
+		case <-trigger.Context.Done():
+			d.leave(key, c)
+			trigger.Respond(ipc.CancelledEvents(trigger)...)
+			return
+		}
+	}
+}
+
+// Stop waiting on a call. The handler is cancelled once nobody is waiting for it.
+func (d *deduplicator) leave(key string, c *call) {
+	d.lock.Lock() // Held so no trigger joins while the call is being abandoned
+	defer d.lock.Unlock()
+	c.lock.Lock()
+	c.waiters--
+	abandoned := c.waiters == 0 && !c.finished
+	c.lock.Unlock()
+	if abandoned {
+		if d.calls[key] == c {
+			delete(d.calls, key)
+		}
+		c.cancel()
+	}
+}
+
+func (d *deduplicator) remove(key string, c *call) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.calls[key] == c {
+		delete(d.calls, key)
+	}
+}
@@ -0,0 +1,158 @@
+package backend
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// A handler that counts its runs and blocks until released.
+func blockingHandler(runs *atomic.Int32, started chan<- struct{}, release <-chan struct{}) HandlerFunc {
+	return func(trigger ipc.Trigger) {
+		runs.Add(1)
+		started <- struct{}{}
+		<-release
+		trigger.Respond(ipc.Event{Component: trigger.Component, Action: trigger.Action, Data: "result"})
+	}
+}
+
+// Wait until the in flight call for the trigger has the number of waiters.
+func waitForWaiters(t *testing.T, d *deduplicator, trigger ipc.Trigger, waiters int) {
+	t.Helper()
+	key, _ := d.requestKey(trigger)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		d.lock.Lock()
+		c, ok := d.calls[key]
+		d.lock.Unlock()
+		if ok {
+			c.lock.Lock()
+			joined := c.waiters
+			c.lock.Unlock()
+			if joined == waiters {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d triggers never joined the call", waiters)
+}
+
+// Collect every event sent to a trigger until its stream is closed.
+func drain(t *testing.T, trigger ipc.Trigger) []ipc.Event {
+	t.Helper()
+	events := make([]ipc.Event, 0)
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case batch, ok := <-trigger.Responder:
+			if !ok {
+				return events
+			}
+			events = append(events, batch...)
+		case <-timeout:
+			t.Fatal("response stream was not closed")
+		}
+	}
+}
+
+func TestDeduplicatorSharesInFlightRequest(t *testing.T) {
+	var runs atomic.Int32
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	d := newDeduplicator(func() string { return "profile dev in us-east-1" })
+	handler := d.middleware(blockingHandler(&runs, started, release))
+	workers := newDispatcher(MAX_CONCURRENT_HANDLERS)
+
+	event := ipc.Event{Component: ipc.COMPONENT_REGION_PICKER, Action: ipc.ACTION_LIST_REGIONS}
+	first, second := ipc.NewTrigger(context.Background(), event), ipc.NewTrigger(context.Background(), event)
+	workers.dispatch(first, handler)
+	<-started
+	workers.dispatch(second, handler)
+	waitForWaiters(t, d, first, 2)
+	close(release)
+
+	for _, trigger := range []ipc.Trigger{first, second} {
+		events := drain(t, trigger)
+		if len(events) != 1 || events[0].Data != "result" || events[0].RequestID != trigger.RequestID {
+			t.Errorf("trigger %s got %+v, want the shared result tagged with its own request id", trigger.RequestID, events)
+		}
+	}
+	if runs.Load() != 1 {
+		t.Errorf("handler ran %d times, want 1", runs.Load())
+	}
+}
+
+func TestDispatcherWaitsForSharedHandler(t *testing.T) {
+	var runs atomic.Int32
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	d := newDeduplicator(func() string { return "profile dev in us-east-1" })
+	handler := d.middleware(blockingHandler(&runs, started, release))
+	workers := newDispatcher(MAX_CONCURRENT_HANDLERS)
+
+	event := ipc.Event{Component: ipc.COMPONENT_HEADER, Action: ipc.ACTION_GET_AUTH_DATA}
+	ctx, cancel := context.WithCancel(context.Background())
+	first, second := ipc.NewTrigger(ctx, event), ipc.NewTrigger(context.Background(), event)
+	workers.dispatch(first, handler)
+	<-started
+	workers.dispatch(second, handler)
+	waitForWaiters(t, d, first, 2)
+
+	// The trigger that started the call is cancelled, the other one still waits.
+	// Its worker keeps running the handler, so its stream stays open.
+	cancel()
+	select {
+	case batch := <-first.Responder:
+		if batch[len(batch)-1].Action != ipc.ACTION_CANCELLED {
+			t.Errorf("cancelled trigger got %+v, want a cancelled event", batch)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled trigger got no cancelled event")
+	}
+	if workers.wait(50 * time.Millisecond) {
+		t.Fatal("dispatcher finished while the shared handler was still running")
+	}
+	close(release)
+	if events := drain(t, first); len(events) != 0 {
+		t.Errorf("cancelled trigger got %+v after it was cancelled", events)
+	}
+	if events := drain(t, second); len(events) != 1 || events[0].Data != "result" {
+		t.Errorf("waiting trigger got %+v, want the shared result", events)
+	}
+	if !workers.wait(time.Second) {
+		t.Error("dispatcher did not finish after the shared handler returned")
+	}
+}
+
+func TestDeduplicatorDoesNotShareAcrossIdentities(t *testing.T) {
+	var runs atomic.Int32
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	var identity atomic.Value
+	identity.Store("profile dev in us-east-1")
+	d := newDeduplicator(func() string { return identity.Load().(string) })
+	handler := d.middleware(blockingHandler(&runs, started, release))
+	workers := newDispatcher(MAX_CONCURRENT_HANDLERS)
+
+	event := ipc.Event{Component: ipc.COMPONENT_HEADER, Action: ipc.ACTION_GET_AUTH_DATA}
+	before := ipc.NewTrigger(context.Background(), event)
+	workers.dispatch(before, handler)
+	<-started
+
+	// The user switched profile while the first request was in flight
+	identity.Store("profile prod in us-east-1")
+	after := ipc.NewTrigger(context.Background(), event)
+	workers.dispatch(after, handler)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("the request after the switch joined the one for the previous identity")
+	}
+	close(release)
+	drain(t, before)
+	drain(t, after)
+	if runs.Load() != 2 {
+		t.Errorf("handler ran %d times, want once per identity", runs.Load())
+	}
+}
@@ -0,0 +1,114 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+	"github.com/livinlefevreloca/canopy/internal/logging"
+)
+
+// The dispatcher runs every trigger in its own goroutine. A semaphore bounds
+// how many handlers run at once; triggers over the limit wait in their
+// goroutine so the server loop is never blocked by a slow handler.
+// Handlers may respond any number of times, the dispatcher closes the
+// response stream once the handler returns.
+type dispatcher struct {
+	workers      chan struct{}              // Semaphore with one slot per concurrent handler
+	inFlightLock sync.Mutex                 // Protects inFlight and nextId
+	inFlight     map[uint64]inFlightRequest // In flight requests by id, for logging and shutdown
+	nextId       uint64
+	running      sync.WaitGroup // Done once every dispatched trigger has finished
+}
+
+type inFlightRequest struct {
+	name   string             // Component/Action of the trigger
+	cancel context.CancelFunc // Cancels the trigger on shutdown
+}
+
+func newDispatcher(maxWorkers int) *dispatcher {
+	return &dispatcher{
+		workers:  make(chan struct{}, maxWorkers),
+		inFlight: make(map[uint64]inFlightRequest),
+	}
+}
+
+func (d *dispatcher) dispatch(trigger ipc.Trigger, handler func(ipc.Trigger)) {
+	// The dispatcher can cancel the trigger too, so it can be stopped on shutdown
+	ctx, cancel := context.WithCancel(logging.WithRequestID(trigger.Context, trigger.RequestID))
+	trigger.Context = ctx
+	id := d.track(trigger, cancel)
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+		defer d.untrack(id)
+		defer trigger.Close() // The handler is done, end the response stream
+		select {
+		case d.workers <- struct{}{}: // Wait for a free worker slot
+		case <-trigger.Context.Done():
+			slog.InfoContext(trigger.Context, "Trigger cancelled before it was handled", "component", trigger.Component, "action", trigger.Action)
+			trigger.Respond(ipc.CancelledEvents(trigger)...)
+			return
+		}
+		defer func() { <-d.workers }() // Release the slot
+		handler(trigger)
+	}()
+}
+
+func (d *dispatcher) track(trigger ipc.Trigger, cancel context.CancelFunc) uint64 {
+	d.inFlightLock.Lock()
+	defer d.inFlightLock.Unlock()
+	d.nextId++
+	d.inFlight[d.nextId] = inFlightRequest{name: trigger.Component + "/" + trigger.Action, cancel: cancel}
+	slog.DebugContext(trigger.Context, "Dispatching request", "id", d.nextId, "component", trigger.Component, "action", trigger.Action, "inFlight", len(d.inFlight))
+	return d.nextId
+}
+
+func (d *dispatcher) untrack(id uint64) {
+	d.inFlightLock.Lock()
+	defer d.inFlightLock.Unlock()
+	if request, ok := d.inFlight[id]; ok {
+		request.cancel() // Release the context
+	}
+	delete(d.inFlight, id)
+	slog.Debug("Finished request", "id", id, "inFlight", len(d.inFlight))
+}
+
+// The Component/Action of every request that is still being handled.
+func (d *dispatcher) inFlightRequests() []string {
+	d.inFlightLock.Lock()
+	defer d.inFlightLock.Unlock()
+	requests := make([]string, 0, len(d.inFlight))
+	for _, request := range d.inFlight {
+		requests = append(requests, request.name)
+	}
+	return requests
+}
+
+// Cancel every request that is still being handled. Handlers waiting on AWS,
+// an MFA code or an SSO login give up and answer with a cancelled event.
+func (d *dispatcher) cancelAll() {
+	d.inFlightLock.Lock()
+	defer d.inFlightLock.Unlock()
+	for _, request := range d.inFlight {
+		request.cancel()
+	}
+}
+
+// Wait for every dispatched trigger to finish. Returns false if they did not
+// finish within the timeout.
+func (d *dispatcher) wait(timeout time.Duration) bool {
+	finished := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,62 @@
+package backend
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// A HandlerFunc answers a single trigger. It may respond any number of times,
+// the response stream is closed for it once it returns.
+type HandlerFunc func(trigger ipc.Trigger)
+
+// UnsupportedActionError is sent back for triggers no handler is registered for.
+type UnsupportedActionError struct {
+	Component string
+	Action    string
+}
+
+func (e *UnsupportedActionError) Error() string {
+	return fmt.Sprintf("unsupported action %s/%s", e.Component, e.Action)
+}
+
+// Handle registers the handler for a Component/Action pair, replacing any
+// handler registered for it before. The middlewares only wrap this handler,
+// inside the ones added with Use. Handlers must be registered before Run.
+func (s *Server) Handle(component string, action string, handler HandlerFunc, middlewares ...Middleware) {
+	key := route{component, action}
+	if _, ok := s.handlers[key]; ok {
+		slog.Warn("Replacing handler", "component", component, "action", action)
+	}
+	s.handlers[key] = chain(handler, middlewares)
+}
+
+type route struct {
+	component string
+	action    string
+}
+
+// Find the handler for a trigger, or one answering that the action is unsupported.
+func (s *Server) handlerFor(trigger ipc.Trigger) HandlerFunc {
+	if handler, ok := s.handlers[route{trigger.Component, trigger.Action}]; ok {
+		return handler
+	}
+	return unsupportedAction
+}
+
+func unsupportedAction(trigger ipc.Trigger) {
+	err := &UnsupportedActionError{Component: trigger.Component, Action: trigger.Action}
+	slog.WarnContext(trigger.Context, "No handler registered for trigger", "component", trigger.Component, "action", trigger.Action)
+	triggerErrorMessage(err.Error(), trigger)
+}
+
+// Middleware for handlers that replace the config. Only one of these runs at
+// a time while handlers that only read the config keep running.
+func (s *Server) mutating(next HandlerFunc) HandlerFunc {
+	return func(trigger ipc.Trigger) {
+		s.mutateLock.Lock()
+		defer s.mutateLock.Unlock()
+		next(trigger)
+	}
+}
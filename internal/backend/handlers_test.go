@@ -0,0 +1,115 @@
+package backend
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// Handle a single trigger and return the events sent back for it.
+func handleOne(s *Server, event ipc.Event) []ipc.Event {
+	trigger := ipc.NewTrigger(context.Background(), event)
+	go func() {
+		defer trigger.Close()
+		chain(s.handleTrigger, s.middlewares)(trigger)
+	}()
+	events := make([]ipc.Event, 0)
+	for batch := range trigger.Responder {
+		events = append(events, batch...)
+	}
+	return events
+}
+
+func TestHandleTriggerRejectsUnknownActions(t *testing.T) {
+	tx, push := make(chan ipc.Trigger), make(chan []ipc.Event)
+	s := NewServer(&tx, &push, "", "")
+
+	tests := []struct {
+		name   string
+		event  ipc.Event
+		want   string
+		failed bool // Whether the component is told the request failed, only components that send triggers are
+	}{
+		{
+			name:   "unregistered action",
+			event:  ipc.Event{Component: ipc.COMPONENT_SET_ACCESS_KEYS, Action: ipc.ACTION_LIST_REGIONS},
+			want:   (&UnsupportedActionError{Component: ipc.COMPONENT_SET_ACCESS_KEYS, Action: ipc.ACTION_LIST_REGIONS}).Error(),
+			failed: true,
+		},
+		{
+			name:  "unregistered component",
+			event: ipc.Event{Component: "NoSuchView", Action: ipc.ACTION_GET_AUTH_DATA},
+			want:  (&UnsupportedActionError{Component: "NoSuchView", Action: ipc.ACTION_GET_AUTH_DATA}).Error(),
+		},
+		{
+			name:   "registered action with the wrong payload",
+			event:  ipc.Event{Component: ipc.COMPONENT_SET_ACCESS_KEYS, Action: ipc.ACTION_SET_ACCESS_KEYS, Data: "keys"},
+			want:   "invalid payload",
+			failed: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := handleOne(s, test.event)
+			if test.failed {
+				if len(events) == 0 || events[0].Component != test.event.Component || events[0].Action != ipc.ACTION_FAILED {
+					t.Fatalf("got %+v, want a failed event for %s first", events, test.event.Component)
+				}
+				failed := events[0].Data.(ipc.FailedData)
+				if failed.Action != test.event.Action || !strings.Contains(failed.Message, test.want) {
+					t.Errorf("got failed event %+v, want it for %s with the error", failed, test.event.Action)
+				}
+				events = events[1:]
+			}
+			if len(events) != 2 || events[1].Action != ipc.ACTION_SHOW_ERROR_MESSAGE {
+				t.Fatalf("got %+v, want an error event", events)
+			}
+			message := events[1].Data.(ipc.ErrorData).Message
+			if !strings.Contains(message, test.want) {
+				t.Errorf("got error %q, want it to contain %q", message, test.want)
+			}
+		})
+	}
+}
+
+func TestHandlersRequireCredentials(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	tx, push := make(chan ipc.Trigger), make(chan []ipc.Event)
+	s := NewServer(&tx, &push, "", "")
+	close(s.loaded) // No config could be loaded
+
+	// Handlers using the current credentials refuse to run without them
+	for _, event := range []ipc.Event{
+		{Component: ipc.COMPONENT_ASSUME_ROLE, Action: ipc.ACTION_STEP_BACK_ROLE},
+		{Component: ipc.COMPONENT_CREDENTIALS_SERVER, Action: ipc.ACTION_TOGGLE_CREDENTIALS_SERVER},
+	} {
+		events := handleOne(s, event)
+		if len(events) == 0 || events[0].Action != ipc.ACTION_FAILED || events[0].Data.(ipc.FailedData).Message != "No AWS configuration is loaded" {
+			t.Errorf("got %+v for %s, want it to fail without a config", events, event.Action)
+		}
+	}
+	if s.credentialsServerData().Running {
+		t.Error("the credentials endpoint was started without credentials")
+	}
+
+	// The SSO browser runs without a config, that is how users get one
+	browse := ipc.Event{Component: ipc.COMPONENT_SSO_BROWSER, Action: ipc.ACTION_LIST_SSO_ACCOUNTS, Data: ipc.SSOSessionData{Session: "work"}}
+	events := handleOne(s, browse)
+	if len(events) == 0 || !strings.Contains(events[0].Data.(ipc.FailedData).Message, "No SSO session work") {
+		t.Errorf("got %+v, want the handler to look for the session", events)
+	}
+
+	// But not once the SSO session has expired
+	s.configLock.Lock()
+	s.ssoExpired = true
+	s.configLock.Unlock()
+	events = handleOne(s, browse)
+	if len(events) != 3 || events[0].Action != ipc.ACTION_FAILED || events[2].Action != ipc.ACTION_MUST_REAUTHENTICATE_SSO {
+		t.Errorf("got %+v, want to be asked to reauthenticate", events)
+	}
+}
@@ -0,0 +1,118 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// MFA prompts waiting for the user to answer them.
+type mfaPrompts struct {
+	lock    sync.Mutex                       // Protects pending
+	pending map[string]chan ipc.MFATokenData // Where to send the answer, by prompt id
+}
+
+func newMFAPrompts() *mfaPrompts {
+	return &mfaPrompts{pending: make(map[string]chan ipc.MFATokenData)}
+}
+
+func (p *mfaPrompts) add(id string, answer chan ipc.MFATokenData) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pending[id] = answer
+}
+
+func (p *mfaPrompts) remove(id string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.pending, id)
+}
+
+// Hand an answer to the prompt waiting for it. Returns false if nothing is waiting anymore.
+func (p *mfaPrompts) answer(data ipc.MFATokenData) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	answer, ok := p.pending[data.PromptID]
+	if ok {
+		delete(p.pending, data.PromptID)
+		answer <- data
+	}
+	return ok
+}
+
+func (s *Server) registerMFAHandlers() {
+	s.Handle(ipc.COMPONENT_MFA_MODAL, ipc.ACTION_PROVIDE_MFA_TOKEN, s.handleProvideMFAToken)
+}
+
+// Ask the user for the code of an MFA device and wait for the answer. The
+// prompt is pushed rather than sent on a trigger because credentials can be
+// refreshed in the middle of any request, or of none.
+func (s *Server) promptMFA(ctx context.Context, serialNumber string) (string, error) {
+	id := ipc.NewRequestID()
+	answer := make(chan ipc.MFATokenData, 1)
+	s.prompts.add(id, answer)
+	defer s.prompts.remove(id)
+	defer s.publish(mfaPromptClosedEvents(id)) // Tell every tui, not just the one that answered
+
+	s.publish([]ipc.Event{
+		{
+			Component: ipc.COMPONENT_TUI,
+			Action:    ipc.ACTION_SHOW_MFA_MODAL,
+			Data:      nil,
+		},
+		{
+			Component: ipc.COMPONENT_MFA_MODAL,
+			Action:    ipc.ACTION_REQUEST_MFA_TOKEN,
+			Data: ipc.MFARequestData{
+				PromptID:     id,
+				SerialNumber: serialNumber,
+			},
+		},
+	})
+
+	timeout := time.NewTimer(ipc.MFA_PROMPT_TIMEOUT)
+	defer timeout.Stop()
+	select {
+	case data := <-answer:
+		if data.Cancelled {
+			return "", errors.New("no MFA code was entered")
+		}
+		return data.Token, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-timeout.C:
+		slog.WarnContext(ctx, "Timed out waiting for MFA code", "serialNumber", serialNumber)
+		return "", errors.New("timed out waiting for an MFA code")
+	}
+}
+
+// The modal closes once no other prompt is waiting, prompts for different
+// requests can be open at the same time.
+func mfaPromptClosedEvents(id string) []ipc.Event {
+	return []ipc.Event{{
+		Component: ipc.COMPONENT_MFA_MODAL,
+		Action:    ipc.ACTION_MFA_PROMPT_CLOSED,
+		Data:      ipc.MFAPromptClosedData{PromptID: id},
+	}}
+}
+
+func (s *Server) handleProvideMFAToken(trigger ipc.Trigger) {
+	tokenData, err := ipc.Handle[ipc.MFATokenData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	if !s.prompts.answer(tokenData) {
+		triggerErrorMessage("The MFA prompt is no longer waiting for a code", trigger)
+		return
+	}
+	trigger.Respond(ipc.Event{
+		Component: ipc.COMPONENT_MFA_MODAL,
+		Action:    ipc.ACTION_PROVIDE_MFA_TOKEN,
+		Data:      nil,
+	})
+}
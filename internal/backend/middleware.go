@@ -0,0 +1,151 @@
+package backend
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// A Middleware wraps a handler to add behaviour shared by many handlers.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Handlers that take longer than this are logged as slow
+const SLOW_HANDLER_THRESHOLD = 5 * time.Second
+
+// Use adds middlewares that wrap every handler. The first middleware added is
+// the outermost one. Middlewares must be added before Run.
+func (s *Server) Use(middlewares ...Middleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// Wrap a handler in middlewares so the first one runs first.
+func chain(handler HandlerFunc, middlewares []Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// logRequests logs every trigger when it starts and finishes.
+func logRequests(next HandlerFunc) HandlerFunc {
+	return func(trigger ipc.Trigger) {
+		logger := slog.With("component", trigger.Component, "action", trigger.Action)
+		logger.InfoContext(trigger.Context, "Handling trigger")
+		next(trigger)
+		if err := trigger.Context.Err(); err != nil {
+			logger.InfoContext(trigger.Context, "Finished handling trigger", "reason", err)
+			return
+		}
+		logger.InfoContext(trigger.Context, "Finished handling trigger")
+	}
+}
+
+// recoverPanics turns a panicking handler into an error shown to the user
+// instead of taking down the whole backend.
+func recoverPanics(next HandlerFunc) HandlerFunc {
+	return func(trigger ipc.Trigger) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				slog.ErrorContext(trigger.Context, "Handler panicked", "component", trigger.Component, "action", trigger.Action, "panic", recovered, "stack", string(debug.Stack()))
+				message := fmt.Sprintf("Internal error while handling %s/%s: %v", trigger.Component, trigger.Action, recovered)
+				trigger.Respond(append(ipc.FailedEvents(trigger, message), ipc.ErrorEvents(message)...)...)
+			}
+		}()
+		next(trigger)
+	}
+}
+
+// requireCredentials only runs the handler when a config is loaded and its
+// SSO session is still valid. Otherwise the user is asked to reauthenticate.
+func (s *Server) requireCredentials(next HandlerFunc) HandlerFunc {
+	return s.requireSSOLogin(func(trigger ipc.Trigger) {
+		if config, _ := s.getConfig(); config == nil {
+			triggerErrorMessage("No AWS configuration is loaded", trigger)
+			return
+		}
+		next(trigger)
+	})
+}
+
+// requireSSOLogin only runs the handler when the SSO session of the config is
+// still valid, but also when no config is loaded. For handlers that can get the
+// user credentials when they have none, like browsing the SSO accounts.
+func (s *Server) requireSSOLogin(next HandlerFunc) HandlerFunc {
+	return func(trigger ipc.Trigger) {
+		select {
+		case <-s.loaded: // The config the server started with is loaded
+		case <-trigger.Context.Done():
+			trigger.Respond(ipc.CancelledEvents(trigger)...)
+			return
+		}
+		if _, ssoExpired := s.getConfig(); ssoExpired {
+			slog.InfoContext(trigger.Context, "SSO session expired, prompting reauthentication", "component", trigger.Component, "action", trigger.Action)
+			trigger.Respond(append(ipc.FailedEvents(trigger, "The SSO session has expired"), reauthenticateEvents()...)...)
+			return
+		}
+		next(trigger)
+	}
+}
+
+// Timing statistics of every action that has been handled.
+type timings struct {
+	lock    sync.Mutex
+	actions map[route]*timing
+}
+
+type timing struct {
+	count int
+	total time.Duration
+	max   time.Duration
+}
+
+func newTimings() *timings {
+	return &timings{actions: make(map[route]*timing)}
+}
+
+// middleware measures how long every handler takes.
+func (t *timings) middleware(next HandlerFunc) HandlerFunc {
+	return func(trigger ipc.Trigger) {
+		start := time.Now()
+		next(trigger)
+		elapsed := time.Since(start)
+		if elapsed > SLOW_HANDLER_THRESHOLD {
+			slog.WarnContext(trigger.Context, "Slow handler", "component", trigger.Component, "action", trigger.Action, "duration", elapsed)
+		} else {
+			slog.DebugContext(trigger.Context, "Handler timing", "component", trigger.Component, "action", trigger.Action, "duration", elapsed)
+		}
+		t.record(route{trigger.Component, trigger.Action}, elapsed)
+	}
+}
+
+func (t *timings) record(key route, elapsed time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	stats, ok := t.actions[key]
+	if !ok {
+		stats = &timing{}
+		t.actions[key] = stats
+	}
+	stats.count++
+	stats.total += elapsed
+	stats.max = max(stats.max, elapsed)
+}
+
+// Log the timing statistics of every action.
+func (t *timings) log() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for key, stats := range t.actions {
+		slog.Info("Action timings",
+			"component", key.component,
+			"action", key.action,
+			"count", stats.count,
+			"average", stats.total/time.Duration(stats.count),
+			"max", stats.max,
+		)
+	}
+}
@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"log/slog"
+
+	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+func (s *Server) registerProfileEditorHandlers() {
+	s.Handle(ipc.COMPONENT_PROFILE_EDITOR, ipc.ACTION_SAVE_CONFIG_SECTION, s.handleSaveConfigSection, s.mutating)
+	s.Handle(ipc.COMPONENT_PROFILE_EDITOR, ipc.ACTION_DELETE_CONFIG_SECTION, s.handleDeleteConfigSection, s.mutating)
+}
+
+// Add a profile or sso-session to the config file, or replace one.
+func (s *Server) handleSaveConfigSection(trigger ipc.Trigger) {
+	sectionData, err := ipc.Handle[ipc.ConfigSectionData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	section := awsAuth.ConfigSection{
+		Kind:       sectionData.Kind,
+		Name:       sectionData.Name,
+		Properties: make([][2]string, 0, len(sectionData.Properties)),
+	}
+	for _, property := range sectionData.Properties {
+		section.Properties = append(section.Properties, [2]string{property.Key, property.Value})
+	}
+	if err := awsAuth.SaveConfigSection(sectionData.Original, section); err != nil {
+		configSectionInvalid("Not saved: "+err.Error(), trigger)
+		return
+	}
+
+	sectionData.Original = sectionData.Name // What the view edits from now on
+	trigger.Respond(profilesChangedEvent(), ipc.Event{
+		Component: ipc.COMPONENT_PROFILE_EDITOR,
+		Action:    ipc.ACTION_SAVE_CONFIG_SECTION,
+		Data:      sectionData,
+	})
+}
+
+func (s *Server) handleDeleteConfigSection(trigger ipc.Trigger) {
+	sectionData, err := ipc.Handle[ipc.ConfigSectionData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	if err := awsAuth.DeleteConfigSection(sectionData.Kind, sectionData.Name); err != nil {
+		configSectionInvalid("Not deleted: "+err.Error(), trigger)
+		return
+	}
+
+	trigger.Respond(profilesChangedEvent(), ipc.Event{
+		Component: ipc.COMPONENT_PROFILE_EDITOR,
+		Action:    ipc.ACTION_DELETE_CONFIG_SECTION,
+		Data:      sectionData,
+	})
+}
+
+// Tell the editor why the file was not changed. The message is shown in the
+// editor itself so the user can fix the section without retyping it.
+func configSectionInvalid(message string, trigger ipc.Trigger) {
+	if trigger.Context.Err() != nil {
+		triggerErrorMessage(message, trigger) // Reports the cancellation
+		return
+	}
+	slog.WarnContext(trigger.Context, "Config file was not changed", "error", message)
+	trigger.Respond(ipc.Event{
+		Component: ipc.COMPONENT_PROFILE_EDITOR,
+		Action:    ipc.ACTION_CONFIG_SECTION_INVALID,
+		Data:      ipc.ErrorData{Message: message},
+	})
+}
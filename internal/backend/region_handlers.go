@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
+	"github.com/livinlefevreloca/canopy/internal/aws/regions"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// How long listing the enabled regions may take before the fallback list is shown
+const REGION_LIST_TIMEOUT = 10 * time.Second
+
+func (s *Server) registerRegionHandlers() {
+	s.Handle(ipc.COMPONENT_REGION_PICKER, ipc.ACTION_LIST_REGIONS, s.handleListRegions, s.dedupe.middleware, s.requireCredentials)
+	s.Handle(ipc.COMPONENT_REGION_PICKER, ipc.ACTION_CHANGE_REGION, s.handleChangeRegion, s.requireCredentials, s.mutating)
+}
+
+// List the regions enabled for the account. If they cannot be listed every
+// region is offered, with the reason so the user knows some may not work.
+func (s *Server) handleListRegions(trigger ipc.Trigger) {
+	config, _ := s.getConfig()
+	regionsData := ipc.RegionsData{
+		Current: config.Region,
+		Regions: make([]ipc.RegionData, 0),
+	}
+
+	trigger.Progress("Loading the enabled regions...")
+	ctx, cancel := context.WithTimeout(trigger.Context, REGION_LIST_TIMEOUT)
+	defer cancel()
+	enabled, err := regions.List(ctx, *config.Config)
+	if err != nil {
+		if trigger.Context.Err() != nil {
+			trigger.Respond(ipc.CancelledEvents(trigger)...)
+			return
+		}
+		slog.WarnContext(trigger.Context, "Failed to list the enabled regions, using the fallback list", "error", err)
+		regionsData.Offline = err.Error()
+		enabled = regions.Fallback()
+	}
+	for _, region := range enabled {
+		regionsData.Regions = append(regionsData.Regions, ipc.RegionData{Name: region.Name, OptIn: region.OptIn})
+	}
+	trigger.Respond(ipc.Event{
+		Component: ipc.COMPONENT_REGION_PICKER,
+		Action:    ipc.ACTION_LIST_REGIONS,
+		Data:      regionsData,
+	})
+}
+
+// Switch the active identity to another region. The credentials are kept, only
+// the region calls are made in changes. It is remembered for the profile.
+func (s *Server) handleChangeRegion(trigger ipc.Trigger) {
+	regionData, err := ipc.Handle[ipc.ChangeRegionData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	if regionData.Region == "" {
+		triggerErrorMessage("A region is required", trigger)
+		return
+	}
+	current, _ := s.getConfig()
+
+	trigger.Progress("Switching to " + regionData.Region + "...")
+	config := current.WithRegion(regionData.Region)
+	if err := config.VerifyRegion(trigger.Context); err != nil {
+		triggerErrorMessage("Failed to use region "+regionData.Region+": "+err.Error(), trigger)
+		return
+	}
+	s.setConfig(config)
+	slog.InfoContext(trigger.Context, "Switched region", "identity", config.Identity(), "region", regionData.Region)
+
+	if config.Profile != nil {
+		if err := regions.Remember(config.Profile.Name, regionData.Region); err != nil {
+			slog.WarnContext(trigger.Context, "Failed to remember the region", "profile", config.Profile.Name, "error", err)
+		}
+	}
+	trigger.Respond(authChangedEvent(config), ipc.Event{
+		Component: ipc.COMPONENT_REGION_PICKER,
+		Action:    ipc.ACTION_CHANGE_REGION,
+		Data:      nil,
+	})
+}
+
+// The region to load a profile in: the one last used with it, otherwise the
+// region of the profile. Profiles without one get current, so switching to
+// them keeps the region that was in use.
+func regionFor(profile string, current string) string {
+	profile = awsAuth.ResolveProfile(profile)
+	if region := regions.Remembered(profile); region != "" {
+		return region
+	}
+	if profiles, err := awsAuth.LoadProfiles(); err == nil {
+		if model, ok := profiles.Get(profile); ok && model.Region != "" {
+			return model.Region
+		}
+	}
+	return current
+}
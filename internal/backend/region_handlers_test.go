@@ -0,0 +1,70 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/livinlefevreloca/canopy/internal/aws/regions"
+)
+
+const regionConfig = `[default]
+region = us-east-1
+
+[profile eu]
+region = eu-west-1
+
+[profile no-region]
+aws_access_key_id = AKIAEXAMPLE
+`
+
+func TestRegionFor(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(configPath, []byte(regionConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configPath)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_DEFAULT_PROFILE", "")
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	memory := filepath.Join(dir, regions.STATE_DIR, regions.REGIONS_FILE)
+
+	// Without a regions.json the profile's region is used, then the current one
+	if got := regionFor("eu", "us-west-2"); got != "eu-west-1" {
+		t.Errorf("got %s for eu without a regions.json, want its profile region eu-west-1", got)
+	}
+	if got := regionFor("no-region", "us-west-2"); got != "us-west-2" {
+		t.Errorf("got %s for no-region, want the current region us-west-2", got)
+	}
+
+	// The remembered region wins over the profile's
+	if err := regions.Remember("eu", "eu-central-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := regions.Remember("default", "ap-south-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := regionFor("eu", "us-west-2"); got != "eu-central-1" {
+		t.Errorf("got %s for eu, want the remembered eu-central-1", got)
+	}
+	if got := regionFor("", "us-west-2"); got != "ap-south-1" {
+		t.Errorf("got %s without a profile, want the one remembered for default", got)
+	}
+
+	// A corrupt regions.json is ignored, and replaced on the next switch
+	if err := os.WriteFile(memory, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := regionFor("eu", "us-west-2"); got != "eu-west-1" {
+		t.Errorf("got %s for eu with a corrupt regions.json, want its profile region eu-west-1", got)
+	}
+	if err := regions.Remember("no-region", "sa-east-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := regionFor("no-region", "us-west-2"); got != "sa-east-1" {
+		t.Errorf("got %s for no-region, want sa-east-1 remembered over the corrupt file", got)
+	}
+}
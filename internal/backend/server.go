@@ -1,194 +1,338 @@
 package backend
 
 import (
+	"context"
+	"errors"
 	"log/slog"
-	"strings"
+	"sync"
+	"time"
 
 	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
-	awsSso "github.com/livinlefevreloca/canopy/internal/aws/sso"
+	"github.com/livinlefevreloca/canopy/internal/credserver"
 	"github.com/livinlefevreloca/canopy/internal/ipc"
 )
 
+// Maximum number of handlers that run at the same time
+const MAX_CONCURRENT_HANDLERS = 8
+
+// How often the credentials are checked in the background
+const CREDENTIAL_CHECK_INTERVAL = time.Minute
+
+// How long before they expire credentials that can be refreshed without the user are refreshed
+const CREDENTIAL_REFRESH_WINDOW = 5 * time.Minute
+
+// How long before they expire the user is warned about credentials that cannot be refreshed
+const CREDENTIAL_EXPIRY_WARNING = 10 * time.Minute
+
+// How long the server waits for cancelled handlers to finish when quitting
+const SHUTDOWN_TIMEOUT = 5 * time.Second
+
 type Server struct {
-	tx         *chan ipc.Trigger  // Channel for outgoing triggers
-	config     *awsAuth.AWSConfig // AWS configuration
-	ssoExpired bool               // Flag to indicate if SSO session is expired
+	tx          *chan ipc.Trigger     // Channel for outgoing triggers
+	push        *chan []ipc.Event     // Channel for events the server publishes without a trigger
+	profile     string                // Profile to load when the server starts
+	region      string                // Region to load when the server starts
+	loaded      chan struct{}         // Closed once the initial config has been loaded, or failed to
+	configLock  sync.RWMutex          // Protects config and ssoExpired
+	mutateLock  sync.Mutex            // Serializes handlers that replace the config
+	config      *awsAuth.AWSConfig    // AWS configuration
+	ssoExpired  bool                  // Flag to indicate if SSO session is expired
+	mfa         *awsAuth.MFASessions  // MFA codes and cached sessions of profiles with an mfa_serial
+	prompts     *mfaPrompts           // MFA prompts waiting for an answer
+	warned      time.Time             // Expiry the user was last warned about, only used by watchCredentials
+	credsLock   sync.Mutex            // Protects credentials
+	credentials *credserver.Server    // The local credentials endpoint, nil when it is not running
+	dispatcher  *dispatcher           // Runs handlers concurrently
+	handlers    map[route]HandlerFunc // Registered handlers by Component/Action
+	middlewares []Middleware          // Wrap every handler, outermost first
+	dedupe      *deduplicator         // Shares results between identical read only requests
+	timings     *timings              // How long each action took to handle
 }
 
-func NewServer(tx *chan ipc.Trigger, profile string, region string) *Server {
-	config, err := awsAuth.GetAwsConfigFromProfileConfig(profile, region)
-	ssoExpired := false
-	if err != nil {
-		if strings.Contains(err.Error(), "SSO session is expired or invalid") {
-			ssoExpired = true
-		}
-		slog.Error("Failed to get AWS configuration", "error", err)
-		config = nil
-	}
-	return &Server{
+// NewServer creates a server for the profile and region. The config is loaded
+// once the server runs, because the user may have to enter an MFA code for it.
+func NewServer(tx *chan ipc.Trigger, push *chan []ipc.Event, profile string, region string) *Server {
+	server := &Server{
 		tx:         tx,
-		config:     config,
-		ssoExpired: ssoExpired,
+		push:       push,
+		profile:    profile,
+		region:     region,
+		loaded:     make(chan struct{}),
+		config:     nil,
+		ssoExpired: false,
+		prompts:    newMFAPrompts(),
+		dispatcher: newDispatcher(MAX_CONCURRENT_HANDLERS),
+		handlers:   make(map[route]HandlerFunc),
+		timings:    newTimings(),
 	}
+	server.mfa = awsAuth.NewMFASessions(server.promptMFA)
+	server.dedupe = newDeduplicator(server.identity)
+	server.Use(logRequests, recoverPanics, server.timings.middleware)
+	server.registerAuthHandlers()
+	server.registerSSOHandlers()
+	server.registerAssumeRoleHandlers()
+	server.registerMFAHandlers()
+	server.registerSSOBrowserHandlers()
+	server.registerAccessKeysHandlers()
+	server.registerCredentialsServerHandlers()
+	server.registerProfileEditorHandlers()
+	server.registerRegionHandlers()
+	return server
 }
 
+// Run reads triggers until a quit trigger is received. Every other trigger is
+// handed to the dispatcher so a slow handler never blocks the loop.
 func (s *Server) Run() {
-	// Here we would typically start the server, listen for incoming requests,
-	// and handle them accordingly. For now, we'll just simulate a simple run.
 	slog.Info("Server is starting")
-	end := false
-	for {
-		select {
-		case trigger := <-*s.tx:
-			// Handle the trigger
-			end = s.handleTrigger(trigger)
-		}
-
-		if end {
+	ctx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go s.loadInitialConfig(ctx)
+	go s.watchCredentials(ctx)
+	handler := chain(s.handleTrigger, s.middlewares)
+	for trigger := range *s.tx {
+		if trigger.Component == ipc.COMPONENT_QUIT {
+			s.handleQuit(trigger)
 			slog.Info("Server is shutting down")
-			break
+			return
 		}
+		s.dispatcher.dispatch(trigger, handler)
 	}
 }
 
-func (s *Server) handleTrigger(trigger ipc.Trigger) bool {
-	// Process the trigger based on its type
-	switch trigger.Component {
-	case ipc.COMPONENT_HEADER:
-		s.handleHeaderTrigger(trigger)
-	case ipc.COMPONENT_CHANGE_PROFILE:
-		s.handleSwitchProfileView(trigger)
-	case ipc.COMPONENT_REFRESH_SSO:
-		s.handleRefreshSSO(trigger)
-	case ipc.COMPONENT_QUIT:
-		slog.Info("Received quit trigger, shutting down server")
-		events := make([]ipc.Event, 0)
-		events = append(events, ipc.Event{
-			Component: ipc.COMPONENT_QUIT,
-			Action:    ipc.ACTION_END,
-			Data:      nil,
-		})
-		trigger.Responder <- events
-		return true
+func (s *Server) handleQuit(trigger ipc.Trigger) {
+	inFlight := s.dispatcher.inFlightRequests()
+	slog.Info("Received quit trigger, shutting down server", "inFlight", inFlight)
+	if len(inFlight) > 0 {
+		s.dispatcher.cancelAll()
+		if !s.dispatcher.wait(SHUTDOWN_TIMEOUT) {
+			slog.Warn("Handlers did not finish before the shutdown timeout", "inFlight", s.dispatcher.inFlightRequests())
+		}
 	}
-	return false
+	s.stopCredentialsServer()
+	s.timings.log()
+	events := make([]ipc.Event, 0)
+	events = append(events, ipc.Event{
+		Component: ipc.COMPONENT_QUIT,
+		Action:    ipc.ACTION_END,
+		Data:      nil,
+	})
+	trigger.Respond(events...)
+	trigger.Close()
 }
 
-func (s *Server) handleHeaderTrigger(trigger ipc.Trigger) {
-	events := make([]ipc.Event, 0)
-	switch trigger.Action {
-	case ipc.ACTION_GET_AUTH_DATA:
-		if s.ssoExpired {
-			events = append(events, ipc.Event{
-				Component: ipc.COMPONENT_TUI,
-				Action:    ipc.ACTION_SHOW_REAUTHENTICATE_SSO_MODAL,
-				Data:      nil,
-			})
-			events = append(events, ipc.Event{
-				Component: ipc.COMPONENT_REFRESH_SSO,
-				Action:    ipc.ACTION_MUST_REAUTHENTICATE_SSO,
-				Data:      nil,
-			})
-			trigger.Responder <- events
-			slog.Info("SSO session expired, prompting reauthentication")
+func (s *Server) handleTrigger(trigger ipc.Trigger) {
+	if err := ipc.ValidateTrigger(trigger.Event); err != nil {
+		// A pair without a registered payload has no handler either
+		var unregistered *ipc.UnregisteredRouteError
+		if errors.As(err, &unregistered) {
+			unsupportedAction(trigger)
 			return
 		}
-		events = append(events, ipc.Event{
-			Component: ipc.COMPONENT_HEADER,
-			Action:    ipc.ACTION_GET_AUTH_DATA,
-			Data:      s.config.AWSConfigData,
-		})
-		trigger.Responder <- events
+		slog.ErrorContext(trigger.Context, "Rejecting trigger with invalid payload", "component", trigger.Component, "action", trigger.Action, "error", err)
+		triggerErrorMessage(err.Error(), trigger)
+		return
 	}
+	s.handlerFor(trigger)(trigger)
 }
 
-func (s *Server) handleSwitchProfileView(trigger ipc.Trigger) {
-	switch trigger.Action {
-	case ipc.ACTION_CHANGE_PROFILE:
-		profileData, ok := trigger.Data.(ipc.ChangeProfileData)
-		if !ok {
-			panic("Expected ChangeProfileData")
-		}
-		s.refreshAwsConfig(profileData.Profile, s.config.Region, &trigger.Responder)
-		slog.Info("Switched AWS profile", "profile", profileData.Profile)
+// Load the config the server was started with and publish it. Loading may
+// wait for the user to enter an MFA code, so the config is only locked once
+// it is loaded. If the user switched to another identity in the meantime the
+// loaded config is dropped.
+func (s *Server) loadInitialConfig(ctx context.Context) {
+	defer close(s.loaded)
+	region := s.region
+	if region == "" {
+		region = awsAuth.EnvRegion()
+	}
+	if region == "" {
+		region = regionFor(s.profile, "")
+	}
+	config, err := awsAuth.GetAwsConfigFromProfileConfig(ctx, s.profile, region, s.mfa)
 
-		events := make([]ipc.Event, 0)
-		events = append(events, ipc.Event{
-			Component: ipc.COMPONENT_HEADER,
-			Action:    ipc.ACTION_GET_AUTH_DATA,
-			Data:      s.config.AWSConfigData,
-		})
-		events = append(events, ipc.Event{
-			Component: ipc.COMPONENT_CHANGE_PROFILE,
-			Action:    ipc.ACTION_CHANGE_PROFILE,
-			Data:      nil,
-		})
-		trigger.Responder <- events
-	}
-}
-
-func (s *Server) handleRefreshSSO(trigger ipc.Trigger) {
-	switch trigger.Action {
-	case ipc.ACTION_REAUTHENTICATE_SSO:
-		refreshData, ok := trigger.Data.(ipc.ReauthenticateSSOData)
-		if !ok {
-			panic("Expected ReauthenticateSSOData")
+	s.mutateLock.Lock()
+	defer s.mutateLock.Unlock()
+	if current, _ := s.getConfig(); current != nil {
+		slog.Info("Dropping the initial config, the user switched identity while it was loading", "profile", s.profile, "current", current.Identity())
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to get AWS configuration", "error", err)
+		if awsAuth.IsSSOExpired(err) {
+			s.configLock.Lock()
+			s.ssoExpired = true // Handlers that need credentials ask the user to reauthenticate
+			s.configLock.Unlock()
 		}
-		err := awsSso.ExecAwsSSOLogin(refreshData.Profile)
-		if err != nil {
-			slog.Error("Failed to reauthenticate SSO session", "error", err)
-			triggerErrorMessage("Failed to reauthenticate SSO session: "+err.Error(), &trigger.Responder)
+		return
+	}
+	s.setConfig(config)
+	s.publish([]ipc.Event{authChangedEvent(config)})
+}
+
+// Publish events to the tui without a trigger.
+func (s *Server) publish(events []ipc.Event) {
+	*s.push <- events
+}
+
+// Periodically retrieve the credentials so an SSO session that expires while
+// canopy is open is noticed before the user runs into it. Credentials about to
+// expire are refreshed if they can be, otherwise the user is warned.
+func (s *Server) watchCredentials(ctx context.Context) {
+	ticker := time.NewTicker(CREDENTIAL_CHECK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			config, ssoExpired := s.getConfig()
+			if config == nil || ssoExpired {
+				continue
+			}
+			if _, err := awsAuth.RetrieveCredentials(ctx, config.Config); awsAuth.IsSSOExpired(err) {
+				s.markSSOExpired()
+				continue
+			}
+			s.checkExpiry(ctx, config)
 		}
+	}
+}
 
-		region := ""
-		if s.config != nil {
-			region = s.config.Region
-		}
+func (s *Server) checkExpiry(ctx context.Context, config *awsAuth.AWSConfig) {
+	if config.Expires.IsZero() {
+		return
+	}
+	remaining := time.Until(config.Expires)
+	if remaining < CREDENTIAL_REFRESH_WINDOW && config.CanRefresh() && s.refreshCredentials(ctx, config) {
+		return
+	}
+	if remaining < CREDENTIAL_EXPIRY_WARNING && !s.warned.Equal(config.Expires) {
+		s.warned = config.Expires // Warn once per set of credentials
+		slog.Info("Credentials are about to expire", "identity", config.Identity(), "expires", config.Expires)
+		s.publish([]ipc.Event{{
+			Component: ipc.COMPONENT_HEADER,
+			Action:    ipc.ACTION_CREDENTIALS_EXPIRING,
+			Data: ipc.CredentialsExpiringData{
+				Identity: config.Identity(),
+				Expires:  config.Expires,
+			},
+		}})
+	}
+}
 
-		s.refreshAwsConfig(refreshData.Profile, region, &trigger.Responder)
-		slog.Info("Reauthenticated SSO session")
-		s.ssoExpired = false
+// Replace the credentials of config with new ones. Returns false if they could
+// not be refreshed, or config was replaced by a handler in the meantime.
+func (s *Server) refreshCredentials(ctx context.Context, config *awsAuth.AWSConfig) bool {
+	if !s.mutateLock.TryLock() {
+		return false // A handler is replacing the config, check again on the next tick
+	}
+	defer s.mutateLock.Unlock()
+	if current, _ := s.getConfig(); current != config {
+		return false
+	}
+	refreshed, err := config.Refresh(ctx)
+	if err != nil {
+		slog.Warn("Failed to refresh credentials", "identity", config.Identity(), "error", err)
+		return false
+	}
+	s.setConfig(refreshed)
+	s.publish([]ipc.Event{authChangedEvent(refreshed)})
+	return true
+}
 
-		events := make([]ipc.Event, 0)
-		events = append(events, ipc.Event{
-			Component: ipc.COMPONENT_HEADER,
-			Action:    ipc.ACTION_GET_AUTH_DATA,
-			Data:      s.config.AWSConfigData,
-		})
-		events = append(events, ipc.Event{
-			Component: ipc.COMPONENT_REFRESH_SSO,
-			Action:    ipc.ACTION_FINISH_REAUTHENTICATE_SSO,
-			Data:      nil,
-		})
-		trigger.Responder <- events
+// Record that the SSO session expired and ask the user to reauthenticate.
+// The tui is only prompted the first time so it is not spammed every check.
+func (s *Server) markSSOExpired() {
+	s.configLock.Lock()
+	alreadyExpired := s.ssoExpired
+	s.ssoExpired = true
+	s.configLock.Unlock()
+	if !alreadyExpired {
+		slog.Info("SSO session expired, prompting reauthentication")
+		s.publish(reauthenticateEvents())
 	}
 }
 
-func triggerErrorMessage(errorMessage string, responder *chan []ipc.Event) {
+// The event publishing the current identity to every subscriber of the auth topic.
+func authChangedEvent(config *awsAuth.AWSConfig) ipc.Event {
+	return ipc.Event{
+		Component: ipc.TOPIC_AUTH_CHANGED,
+		Action:    ipc.ACTION_AUTH_CHANGED,
+		Data:      config.AWSConfigData,
+	}
+}
+
+// The event telling every subscriber to reload the profiles after the AWS config or credentials file was written.
+func profilesChangedEvent() ipc.Event {
+	return ipc.Event{
+		Component: ipc.TOPIC_PROFILES_CHANGED,
+		Action:    ipc.ACTION_PROFILES_CHANGED,
+		Data:      nil,
+	}
+}
+
+// The events that open the SSO modal and tell it reauthentication is required.
+func reauthenticateEvents() []ipc.Event {
 	events := make([]ipc.Event, 0)
 	events = append(events, ipc.Event{
 		Component: ipc.COMPONENT_TUI,
-		Action:    ipc.ACTION_SHOW_ERROR_MODAL,
+		Action:    ipc.ACTION_SHOW_REAUTHENTICATE_SSO_MODAL,
 		Data:      nil,
 	})
 	events = append(events, ipc.Event{
-		Component: ipc.COMPONENT_ERROR_MODAL,
-		Action:    ipc.ACTION_SHOW_ERROR_MESSAGE,
-		Data: ipc.ErrorData{
-			Message: errorMessage,
-		},
+		Component: ipc.COMPONENT_REFRESH_SSO,
+		Action:    ipc.ACTION_MUST_REAUTHENTICATE_SSO,
+		Data:      nil,
 	})
+	return events
+}
 
-	*responder <- events
+// Get the current config and whether the SSO session has expired.
+func (s *Server) getConfig() (*awsAuth.AWSConfig, bool) {
+	s.configLock.RLock()
+	defer s.configLock.RUnlock()
+	return s.config, s.ssoExpired
 }
 
-func (s *Server) refreshAwsConfig(profile string, region string, responder *chan []ipc.Event) {
-	cfg, err := awsAuth.GetAwsConfigFromProfileConfig(profile, region)
-	if err != nil {
-		slog.Error("Failed to get AWS configuration for new profile", "error", err)
-		triggerErrorMessage("Failed to refresh AWS configuration: "+err.Error(), responder)
+// The identity and region requests are currently answered for, empty if no config is loaded.
+func (s *Server) identity() string {
+	config, _ := s.getConfig()
+	if config == nil {
+		return ""
+	}
+	return config.Identity() + " in " + config.Region
+}
+
+func (s *Server) setConfig(config *awsAuth.AWSConfig) {
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+	s.config = config
+	s.ssoExpired = false
+}
+
+// Send an error to the triggerer. If the trigger was cancelled or timed out the
+// error is most likely a result of that, so the cancellation is reported instead.
+func triggerErrorMessage(errorMessage string, trigger ipc.Trigger) {
+	if trigger.Context.Err() != nil {
+		slog.InfoContext(trigger.Context, "Trigger was cancelled", "component", trigger.Component, "action", trigger.Action, "reason", trigger.Context.Err(), "error", errorMessage)
+		trigger.Respond(ipc.CancelledEvents(trigger)...)
 		return
 	}
-	s.config = cfg
+	slog.ErrorContext(trigger.Context, "Sending error to triggerer", "component", trigger.Component, "action", trigger.Action, "error", errorMessage)
+	// The component is told too, so it stops showing the request as in progress
+	trigger.Respond(append(ipc.FailedEvents(trigger, errorMessage), ipc.ErrorEvents(errorMessage)...)...)
+}
+
+// Load the config for a profile and make it the current config.
+func (s *Server) refreshAwsConfig(ctx context.Context, profile string, region string) (*awsAuth.AWSConfig, error) {
+	cfg, err := awsAuth.GetAwsConfigFromProfileConfig(ctx, profile, region, s.mfa)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get AWS configuration for new profile", "error", err)
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, errors.New("no configuration was returned for profile " + profile)
+	}
+	s.setConfig(cfg)
+	return cfg, nil
 }
@@ -0,0 +1,212 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	awsSso "github.com/livinlefevreloca/canopy/internal/aws/sso"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+const mfaConfig = `[profile base]
+aws_access_key_id = AKIAEXAMPLE
+aws_secret_access_key = secret
+
+[profile mfa]
+role_arn = arn:aws:iam::123456789012:role/Deploy
+source_profile = base
+mfa_serial = arn:aws:iam::123456789012:mfa/me
+region = us-east-1
+`
+
+// Wait for the MFA prompt the server pushes to the tui and return its id.
+func waitForMFAPrompt(t *testing.T, push chan []ipc.Event) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case events := <-push:
+			for _, event := range events {
+				if request, ok := event.Data.(ipc.MFARequestData); ok {
+					return request.PromptID
+				}
+			}
+		case <-timeout:
+			t.Fatal("the server never asked for an MFA code")
+		}
+	}
+}
+
+func TestInitialLoadDoesNotLockWhileWaitingForMFA(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(configPath, []byte(mfaConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configPath)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+
+	tx, push := make(chan ipc.Trigger), make(chan []ipc.Event, 10)
+	s := NewServer(&tx, &push, "mfa", "us-east-1")
+	go s.loadInitialConfig(context.Background())
+	promptID := waitForMFAPrompt(t, push)
+
+	// Mutating handlers can run while the user is entering the code
+	if !s.mutateLock.TryLock() {
+		t.Fatal("the initial load holds the mutate lock while waiting for an MFA code")
+	}
+	s.mutateLock.Unlock()
+
+	s.prompts.answer(ipc.MFATokenData{PromptID: promptID, Cancelled: true})
+	select {
+	case <-s.loaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the initial load did not finish after the prompt was answered")
+	}
+	if config, _ := s.getConfig(); config != nil {
+		t.Errorf("got config %s, want none after the MFA prompt was cancelled", config.Identity())
+	}
+}
+
+func TestMFATriggersOutlastThePrompt(t *testing.T) {
+	for _, action := range []string{
+		ipc.ACTION_CHANGE_PROFILE,
+		ipc.ACTION_ASSUME_ROLE,
+		ipc.ACTION_SET_ACCESS_KEYS,
+		ipc.ACTION_GET_AUTH_DATA,
+		ipc.ACTION_LIST_REGIONS,
+		ipc.ACTION_CHANGE_REGION,
+	} {
+		if timeout := ipc.TimeoutFor(action); timeout <= ipc.MFA_PROMPT_TIMEOUT {
+			t.Errorf("%s times out after %s, before the MFA prompt does after %s", action, timeout, ipc.MFA_PROMPT_TIMEOUT)
+		}
+	}
+}
+
+const ssoConfig = `[profile work]
+sso_session = work
+sso_account_id = 123456789012
+sso_role_name = Admin
+
+[sso-session work]
+sso_start_url = https://example.awsapps.com/start
+sso_region = us-east-1
+`
+
+// An OIDC endpoint where the user never approves the device authorization.
+func pendingOIDCEndpoint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/client/register":
+		json.NewEncoder(w).Encode(map[string]any{
+			"clientId":              "client-id",
+			"clientSecret":          "client-secret",
+			"clientSecretExpiresAt": time.Now().Add(time.Hour).Unix(),
+		})
+	case "/device_authorization":
+		json.NewEncoder(w).Encode(map[string]any{
+			"deviceCode":      "device-code",
+			"userCode":        "ABCD-EFGH",
+			"verificationUri": "https://device.sso.example.com/",
+			"expiresIn":       600,
+			"interval":        1,
+		})
+	default:
+		w.Header().Set("X-Amzn-Errortype", "AuthorizationPendingException")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": "authorization_pending"})
+	}
+}
+
+func TestReauthenticationDoesNotLockWhileWaitingForTheUser(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(configPath, []byte(ssoConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configPath)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("HOME", dir)
+	endpoint := httptest.NewServer(http.HandlerFunc(pendingOIDCEndpoint))
+	defer endpoint.Close()
+	t.Setenv(awsSso.ENDPOINT_ENV, endpoint.URL)
+
+	tx, push := make(chan ipc.Trigger), make(chan []ipc.Event, 10)
+	s := NewServer(&tx, &push, "", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trigger := ipc.NewTrigger(ctx, ipc.Event{
+		Component: ipc.COMPONENT_REFRESH_SSO,
+		Action:    ipc.ACTION_REAUTHENTICATE_SSO,
+		Data:      ipc.ReauthenticateSSOData{Profile: "work"},
+	})
+	go func() {
+		defer trigger.Close()
+		chain(s.handleTrigger, s.middlewares)(trigger)
+	}()
+
+	// Wait until the user is shown the code to enter in the browser
+	timeout := time.After(5 * time.Second)
+	for authorizing := false; !authorizing; {
+		select {
+		case events := <-trigger.Responder:
+			for _, event := range events {
+				authorizing = authorizing || event.Action == ipc.ACTION_SSO_DEVICE_AUTHORIZATION
+			}
+		case <-timeout:
+			t.Fatal("the device authorization was never shown")
+		}
+	}
+	if !s.mutateLock.TryLock() {
+		t.Fatal("reauthenticating holds the mutate lock while the user is in the browser")
+	}
+	s.mutateLock.Unlock()
+
+	cancel()
+	for range trigger.Responder {
+	}
+}
+
+func TestConcurrentMFAPromptsCloseSeparately(t *testing.T) {
+	tx, push := make(chan ipc.Trigger), make(chan []ipc.Event, 10)
+	s := NewServer(&tx, &push, "", "")
+
+	// The initial load and a profile switch both waiting for a code
+	first := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := s.promptMFA(ctx, "arn:aws:iam::123456789012:mfa/me")
+		first <- err
+	}()
+	firstID := waitForMFAPrompt(t, push)
+	second := make(chan string, 1)
+	go func() {
+		code, _ := s.promptMFA(context.Background(), "arn:aws:iam::123456789012:mfa/me")
+		second <- code
+	}()
+	secondID := waitForMFAPrompt(t, push)
+
+	cancel() // The first request gives up
+	<-first
+	closed := <-push
+	if len(closed) != 1 || closed[0].Data.(ipc.MFAPromptClosedData).PromptID != firstID {
+		t.Fatalf("got %+v, want only the first prompt to be closed", closed)
+	}
+
+	s.prompts.answer(ipc.MFATokenData{PromptID: secondID, Token: "123456"})
+	if code := <-second; code != "123456" {
+		t.Errorf("got code %q for the second prompt, want 123456", code)
+	}
+	closed = <-push
+	if len(closed) != 1 || closed[0].Data.(ipc.MFAPromptClosedData).PromptID != secondID {
+		t.Errorf("got %+v, want the second prompt to be closed", closed)
+	}
+}
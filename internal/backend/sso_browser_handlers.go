@@ -0,0 +1,148 @@
+package backend
+
+import (
+	"log/slog"
+
+	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
+	awsSso "github.com/livinlefevreloca/canopy/internal/aws/sso"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+func (s *Server) registerSSOBrowserHandlers() {
+	s.Handle(ipc.COMPONENT_SSO_BROWSER, ipc.ACTION_LIST_SSO_ACCOUNTS, s.handleListSSOAccounts, s.dedupe.middleware, s.requireSSOLogin)
+	s.Handle(ipc.COMPONENT_SSO_BROWSER, ipc.ACTION_LIST_SSO_ROLES, s.handleListSSORoles, s.dedupe.middleware, s.requireSSOLogin)
+	s.Handle(ipc.COMPONENT_SSO_BROWSER, ipc.ACTION_USE_SSO_ROLE, s.handleUseSSORole, s.requireSSOLogin, s.mutating)
+	s.Handle(ipc.COMPONENT_SSO_BROWSER, ipc.ACTION_SAVE_SSO_PROFILE, s.handleSaveSSOProfile, s.requireSSOLogin, s.mutating)
+}
+
+func (s *Server) handleListSSOAccounts(trigger ipc.Trigger) {
+	sessionData, err := ipc.Handle[ipc.SSOSessionData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	_, settings, err := ssoSession(sessionData.Session)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	trigger.Progress("Loading the accounts of " + sessionData.Session + "...")
+	accounts, err := awsSso.ListAccounts(trigger.Context, settings)
+	if err != nil {
+		triggerErrorMessage("Failed to list SSO accounts: "+err.Error(), trigger)
+		return
+	}
+
+	accountsData := ipc.SSOAccountsData{
+		Session:  sessionData.Session,
+		Accounts: make([]ipc.SSOAccountData, 0, len(accounts)),
+	}
+	for _, account := range accounts {
+		accountsData.Accounts = append(accountsData.Accounts, ipc.SSOAccountData{
+			AccountID: account.AccountID,
+			Name:      account.Name,
+			Email:     account.Email,
+		})
+	}
+	trigger.Respond(ipc.Event{
+		Component: ipc.COMPONENT_SSO_BROWSER,
+		Action:    ipc.ACTION_LIST_SSO_ACCOUNTS,
+		Data:      accountsData,
+	})
+}
+
+func (s *Server) handleListSSORoles(trigger ipc.Trigger) {
+	roleData, err := ipc.Handle[ipc.SSORoleData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	_, settings, err := ssoSession(roleData.Session)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	roles, err := awsSso.ListAccountRoles(trigger.Context, settings, roleData.AccountID)
+	if err != nil {
+		triggerErrorMessage("Failed to list the roles of account "+roleData.AccountID+": "+err.Error(), trigger)
+		return
+	}
+	trigger.Respond(ipc.Event{
+		Component: ipc.COMPONENT_SSO_BROWSER,
+		Action:    ipc.ACTION_LIST_SSO_ROLES,
+		Data: ipc.SSORolesData{
+			Session:   roleData.Session,
+			AccountID: roleData.AccountID,
+			Roles:     roles,
+		},
+	})
+}
+
+// Switch to a role of an SSO account without a profile for it.
+func (s *Server) handleUseSSORole(trigger ipc.Trigger) {
+	roleData, err := ipc.Handle[ipc.SSORoleData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	session, settings, err := ssoSession(roleData.Session)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	credentials, err := awsSso.RoleCredentials(settings, roleData.AccountID, roleData.RoleName)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+
+	region := session.Region
+	if current, _ := s.getConfig(); current != nil && current.Region != "" {
+		region = current.Region
+	}
+	trigger.Progress("Getting credentials for " + roleData.RoleName + " in " + roleData.AccountID + "...")
+	config, err := awsAuth.GetAwsConfigFromSSORole(trigger.Context, credentials, roleData.AccountID, roleData.RoleName, region)
+	if err != nil {
+		triggerErrorMessage("Failed to get role credentials: "+err.Error(), trigger)
+		return
+	}
+	s.setConfig(config)
+	slog.InfoContext(trigger.Context, "Switched to SSO role", "accountId", roleData.AccountID, "role", roleData.RoleName)
+
+	trigger.Respond(authChangedEvent(config), ipc.Event{
+		Component: ipc.COMPONENT_SSO_BROWSER,
+		Action:    ipc.ACTION_USE_SSO_ROLE,
+		Data:      nil,
+	})
+}
+
+// Write a profile for a role of an SSO account to the config file.
+func (s *Server) handleSaveSSOProfile(trigger ipc.Trigger) {
+	roleData, err := ipc.Handle[ipc.SSORoleData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	if roleData.Profile == "" {
+		triggerErrorMessage("A profile name is required", trigger)
+		return
+	}
+	session, _, err := ssoSession(roleData.Session)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	region := ""
+	if current, _ := s.getConfig(); current != nil {
+		region = current.Region
+	}
+	if err := awsAuth.AddSSOProfile(roleData.Profile, session, roleData.AccountID, roleData.RoleName, region); err != nil {
+		triggerErrorMessage("Failed to save profile: "+err.Error(), trigger)
+		return
+	}
+	trigger.Respond(profilesChangedEvent(), ipc.Event{
+		Component: ipc.COMPONENT_SSO_BROWSER,
+		Action:    ipc.ACTION_SAVE_SSO_PROFILE,
+		Data:      roleData,
+	})
+}
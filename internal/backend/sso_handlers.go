@@ -0,0 +1,117 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+
+	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
+	awsSso "github.com/livinlefevreloca/canopy/internal/aws/sso"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+func (s *Server) registerSSOHandlers() {
+	s.Handle(ipc.COMPONENT_REFRESH_SSO, ipc.ACTION_REAUTHENTICATE_SSO, s.handleReauthenticateSSO)
+}
+
+// Log in to the SSO session of a profile again and reload it. The login waits
+// for the user in the browser, so only replacing the config at the end holds
+// the mutate lock.
+func (s *Server) handleReauthenticateSSO(trigger ipc.Trigger) {
+	refreshData, err := ipc.Handle[ipc.ReauthenticateSSOData](&trigger.Event)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+	settings, err := ssoLoginSettings(refreshData.Profile)
+	if err != nil {
+		triggerErrorMessage(err.Error(), trigger)
+		return
+	}
+
+	trigger.Progress("Registering with IAM Identity Center...")
+	err = awsSso.Login(trigger.Context, settings, func(authorization awsSso.DeviceAuthorization) {
+		trigger.Respond(ipc.Event{
+			Component: ipc.COMPONENT_REFRESH_SSO,
+			Action:    ipc.ACTION_SSO_DEVICE_AUTHORIZATION,
+			Data: ipc.SSODeviceAuthorizationData{
+				VerificationURI:         authorization.VerificationURI,
+				VerificationURIComplete: authorization.VerificationURIComplete,
+				UserCode:                authorization.UserCode,
+				ExpiresAt:               authorization.ExpiresAt,
+			},
+		})
+	})
+	if err != nil {
+		slog.ErrorContext(trigger.Context, "Failed to reauthenticate SSO session", "error", err)
+		triggerErrorMessage("Failed to reauthenticate SSO session: "+err.Error(), trigger)
+		return
+	}
+
+	trigger.Progress("Loading credentials for " + refreshData.Profile + "...")
+	config, err := s.reloadSSOProfile(trigger.Context, refreshData.Profile)
+	if err != nil {
+		triggerErrorMessage("Failed to refresh AWS configuration: "+err.Error(), trigger)
+		return
+	}
+	slog.InfoContext(trigger.Context, "Reauthenticated SSO session")
+
+	trigger.Respond(authChangedEvent(config), ipc.Event{
+		Component: ipc.COMPONENT_REFRESH_SSO,
+		Action:    ipc.ACTION_FINISH_REAUTHENTICATE_SSO,
+		Data:      nil,
+	})
+}
+
+// Reload an SSO profile after logging in, in the region of the current config.
+func (s *Server) reloadSSOProfile(ctx context.Context, profile string) (*awsAuth.AWSConfig, error) {
+	s.mutateLock.Lock()
+	defer s.mutateLock.Unlock()
+	region := ""
+	if config, _ := s.getConfig(); config != nil {
+		region = config.Region
+	}
+	return s.refreshAwsConfig(ctx, profile, region)
+}
+
+// What to log in to for an SSO profile, from its sso-session if it has one.
+func ssoLoginSettings(profileName string) (awsSso.LoginSettings, error) {
+	profiles, err := awsAuth.LoadProfiles()
+	if err != nil {
+		return awsSso.LoginSettings{}, err
+	}
+	profile, ok := profiles.Get(profileName)
+	if !ok || profile.AuthType != awsAuth.AUTH_TYPE_SSO {
+		return awsSso.LoginSettings{}, &awsSso.SSOLoginError{Message: "Profile " + profileName + " does not use SSO"}
+	}
+	key := profile.SSOSession
+	if key == "" {
+		key = profile.SSOStartURL
+	}
+	session, ok := profiles.SSOLogin(key)
+	if !ok {
+		return awsSso.LoginSettings{}, &awsSso.SSOLoginError{Message: "Profile " + profileName + " uses sso-session " + key + " which does not exist"}
+	}
+	return loginSettings(session), nil
+}
+
+// Find an SSO session by its key, see awsAuth.SSOSession.Key.
+func ssoSession(key string) (*awsAuth.SSOSession, awsSso.LoginSettings, error) {
+	profiles, err := awsAuth.LoadProfiles()
+	if err != nil {
+		return nil, awsSso.LoginSettings{}, err
+	}
+	session, ok := profiles.SSOLogin(key)
+	if !ok {
+		return nil, awsSso.LoginSettings{}, &awsSso.SSOLoginError{Message: "No SSO session " + key + " in the config file"}
+	}
+	return session, loginSettings(session), nil
+}
+
+func loginSettings(session *awsAuth.SSOSession) awsSso.LoginSettings {
+	return awsSso.LoginSettings{
+		SessionName: session.Name,
+		StartURL:    session.StartURL,
+		Region:      session.Region,
+		Scopes:      session.Scopes(),
+	}
+}
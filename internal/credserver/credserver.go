@@ -0,0 +1,163 @@
+package credserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Address the endpoint listens on when none is given, a free port on loopback
+const DEFAULT_ADDRESS = "127.0.0.1:0"
+
+// Path the credentials are served on
+const CREDENTIALS_PATH = "/credentials"
+
+// How long clients may cache the credentials they get. Kept short so they
+// pick up a profile switch soon, whatever the credentials' own expiry is.
+const CLIENT_CACHE_LIFETIME = time.Minute
+
+// How long a client may take to send the request headers
+const READ_HEADER_TIMEOUT = 5 * time.Second
+
+// Environment variables the SDKs and the aws CLI read the endpoint from
+const (
+	ENV_FULL_URI            = "AWS_CONTAINER_CREDENTIALS_FULL_URI"
+	ENV_AUTHORIZATION_TOKEN = "AWS_CONTAINER_AUTHORIZATION_TOKEN"
+)
+
+// CredentialsFunc returns the credentials to serve.
+type CredentialsFunc func(ctx context.Context) (aws.Credentials, error)
+
+// Server serves credentials on localhost in the format of the ECS container
+// credentials endpoint, so any SDK pointed at it with ENV_FULL_URI and
+// ENV_AUTHORIZATION_TOKEN uses them. Requests without the token are refused.
+type Server struct {
+	listener    net.Listener
+	http        *http.Server
+	token       string // Clients must send it in the Authorization header
+	credentials CredentialsFunc
+}
+
+// The body of a credentials response
+type credentialsResponse struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string    `json:",omitempty"`
+	Expiration      time.Time // Required, clients would never ask again without it
+}
+
+// The body of an error response, in the format the SDKs parse
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Listen creates a server listening on address. Only loopback addresses are
+// allowed, the SDKs refuse plain http to anything else and the credentials
+// must not leave the machine.
+func Listen(address string, credentials CredentialsFunc) (*Server, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("the credentials endpoint can only listen on a loopback address, not %s, run containers with --network host to reach it", host)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	server := &Server{
+		listener:    listener,
+		token:       hex.EncodeToString(token),
+		credentials: credentials,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+CREDENTIALS_PATH, server.serveCredentials)
+	server.http = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: READ_HEADER_TIMEOUT,
+	}
+	return server, nil
+}
+
+// Serve answers requests until the server is closed.
+func (s *Server) Serve() error {
+	slog.Info("Serving credentials", "url", s.URL())
+	if err := s.http.Serve(s.listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Close stops the server, waiting for requests being answered up to ctx's deadline.
+func (s *Server) Close(ctx context.Context) error {
+	slog.Info("Stopping credentials endpoint", "url", s.URL())
+	return s.http.Shutdown(ctx)
+}
+
+// URL to set ENV_FULL_URI to.
+func (s *Server) URL() string {
+	return "http://" + s.listener.Addr().String() + CREDENTIALS_PATH
+}
+
+// Token to set ENV_AUTHORIZATION_TOKEN to.
+func (s *Server) Token() string {
+	return s.token
+}
+
+// Env returns the environment variables pointing a client at the server.
+func (s *Server) Env() []string {
+	return []string{
+		ENV_FULL_URI + "=" + s.URL(),
+		ENV_AUTHORIZATION_TOKEN + "=" + s.token,
+	}
+}
+
+func (s *Server) serveCredentials(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(s.token)) != 1 {
+		slog.Warn("Refused credentials request without a valid token", "remote", r.RemoteAddr)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Code: "Unauthorized", Message: "missing or invalid authorization token"})
+		return
+	}
+	creds, err := s.credentials(r.Context())
+	if err != nil {
+		slog.Error("Failed to get credentials to serve", "remote", r.RemoteAddr, "error", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Code: "CredentialsUnavailable", Message: err.Error()})
+		return
+	}
+	expiration := time.Now().Add(CLIENT_CACHE_LIFETIME)
+	if creds.CanExpire && creds.Expires.Before(expiration) {
+		expiration = creds.Expires
+	}
+	slog.Debug("Served credentials", "remote", r.RemoteAddr, "source", creds.Source)
+	writeJSON(w, http.StatusOK, credentialsResponse{
+		AccessKeyId:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		Token:           creds.SessionToken,
+		Expiration:      expiration.UTC(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Failed to write credentials response", "error", err)
+	}
+}
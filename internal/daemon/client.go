@@ -0,0 +1,203 @@
+package daemon
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// Client relays triggers from a tui to a daemon. It reads triggers from the
+// same channel a backend.Server would and answers on their responders, so the
+// TriggerHandler works the same whether the backend is in process or not.
+type Client struct {
+	tx             *chan ipc.Trigger // Channel the tui sends triggers on
+	push           *chan []ipc.Event // Channel the tui receives pushed events on
+	conn           net.Conn
+	codec          *ipc.Codec
+	respondersLock sync.Mutex                 // Protects responders, nextId and lost
+	responders     map[uint64]*pendingTrigger // In flight triggers by id
+	nextId         uint64
+	lost           bool // Set once the connection to the daemon is gone
+}
+
+// A trigger in flight at the daemon. The reader loop sends on its responder
+// while a failed write or the lost connection may end it, so sending and
+// closing share a lock and nothing is sent once it is closed.
+type pendingTrigger struct {
+	lock    sync.Mutex
+	trigger ipc.Trigger
+	closed  bool
+}
+
+func (p *pendingTrigger) send(events []ipc.Event) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.closed {
+		p.trigger.Responder <- events
+	}
+}
+
+// End the response stream, after sending any last events.
+func (p *pendingTrigger) close(events ...ipc.Event) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return
+	}
+	if len(events) > 0 {
+		p.trigger.Responder <- events
+	}
+	p.closed = true
+	p.trigger.Close()
+}
+
+// End the response stream telling the component the request failed.
+func (p *pendingTrigger) fail(message string, events ...ipc.Event) {
+	p.close(append(ipc.FailedEvents(p.trigger, message), events...)...)
+}
+
+// NewClient connects to the daemon listening on socketPath. The socket must
+// belong to the user, so triggers are never sent to a daemon of someone else.
+func NewClient(tx *chan ipc.Trigger, push *chan []ipc.Event, socketPath string) (*Client, error) {
+	if err := checkSocketOwner(socketPath); err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		tx:         tx,
+		push:       push,
+		conn:       conn,
+		codec:      ipc.NewCodec(conn),
+		responders: make(map[uint64]*pendingTrigger),
+	}, nil
+}
+
+// Run relays triggers until a quit trigger is received. The quit trigger is
+// answered locally, it detaches this tui without stopping the daemon.
+func (c *Client) Run() {
+	slog.Info("Attached to daemon", "socket", c.conn.RemoteAddr().String())
+	go c.readFrames()
+	for trigger := range *c.tx {
+		if trigger.Component == ipc.COMPONENT_QUIT {
+			slog.Info("Received quit trigger, detaching from daemon")
+			trigger.Responder <- []ipc.Event{{
+				Component: ipc.COMPONENT_QUIT,
+				Action:    ipc.ACTION_END,
+				Data:      nil,
+			}}
+			trigger.Close()
+			c.detach()
+			return
+		}
+		c.sendTrigger(trigger)
+	}
+}
+
+func (c *Client) sendTrigger(trigger ipc.Trigger) {
+	pending := &pendingTrigger{trigger: trigger}
+	c.respondersLock.Lock()
+	if c.lost {
+		c.respondersLock.Unlock()
+		message := "Lost the connection to the canopy daemon"
+		pending.fail(message, ipc.ErrorEvents(message)...)
+		return
+	}
+	c.nextId++
+	id := c.nextId
+	c.responders[id] = pending
+	c.respondersLock.Unlock()
+
+	frame := ipc.Frame{Kind: ipc.FRAME_TRIGGER, Id: id, Events: []ipc.Event{trigger.Event}}
+	if deadline, ok := trigger.Context.Deadline(); ok {
+		frame.Deadline = deadline
+	}
+	if err := c.codec.Write(frame); err != nil {
+		slog.Error("Failed to send trigger to daemon", "error", err)
+		if pending, ok := c.take(id); ok {
+			message := "Failed to send request to the canopy daemon: " + err.Error()
+			pending.fail(message, ipc.ErrorEvents(message)...)
+		}
+		return
+	}
+	go c.forwardCancel(id, trigger)
+}
+
+// Tell the daemon when a trigger is cancelled while it is still in flight.
+func (c *Client) forwardCancel(id uint64, trigger ipc.Trigger) {
+	<-trigger.Context.Done()
+	c.respondersLock.Lock()
+	_, inFlight := c.responders[id]
+	c.respondersLock.Unlock()
+	if inFlight {
+		c.codec.Write(ipc.Frame{Kind: ipc.FRAME_CANCEL, Id: id})
+	}
+}
+
+func (c *Client) readFrames() {
+	for {
+		frame, err := c.codec.Read()
+		if err != nil {
+			c.connectionLost(err)
+			return
+		}
+		switch frame.Kind {
+		case ipc.FRAME_EVENTS:
+			c.respondersLock.Lock()
+			pending, ok := c.responders[frame.Id]
+			c.respondersLock.Unlock()
+			if ok {
+				pending.send(frame.Events)
+			}
+		case ipc.FRAME_CLOSE:
+			if pending, ok := c.take(frame.Id); ok {
+				pending.close()
+			}
+		case ipc.FRAME_PUSH:
+			*c.push <- frame.Events
+		default:
+			slog.Warn("Ignoring unexpected frame from daemon", "kind", frame.Kind)
+		}
+	}
+}
+
+// Remove a trigger so the reader loop no longer looks it up.
+func (c *Client) take(id uint64) (*pendingTrigger, bool) {
+	c.respondersLock.Lock()
+	defer c.respondersLock.Unlock()
+	pending, ok := c.responders[id]
+	delete(c.responders, id)
+	return pending, ok
+}
+
+// Close the connection without reporting it as lost.
+func (c *Client) detach() {
+	c.respondersLock.Lock()
+	c.lost = true
+	c.respondersLock.Unlock()
+	c.conn.Close()
+}
+
+// Fail every in flight trigger and any later ones once the daemon is gone.
+func (c *Client) connectionLost(err error) {
+	c.respondersLock.Lock()
+	if c.lost {
+		c.respondersLock.Unlock()
+		return // Detached on purpose
+	}
+	c.lost = true
+	responders := c.responders
+	c.responders = make(map[uint64]*pendingTrigger)
+	c.respondersLock.Unlock()
+
+	slog.Error("Lost the connection to the daemon", "error", err)
+	message := "Lost the connection to the canopy daemon: " + err.Error()
+	for _, pending := range responders {
+		pending.fail(message) // The error is pushed once below, not once per trigger
+	}
+	*c.push <- ipc.ErrorEvents(message)
+}
@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// A client attached to one end of a pipe, the other end stands in for the daemon.
+func pipeClient() (*Client, chan ipc.Trigger, chan []ipc.Event, *ipc.Codec, net.Conn) {
+	tx, push := make(chan ipc.Trigger), make(chan []ipc.Event, 10)
+	clientConn, daemonConn := net.Pipe()
+	client := &Client{
+		tx:         &tx,
+		push:       &push,
+		conn:       clientConn,
+		codec:      ipc.NewCodec(clientConn),
+		responders: make(map[uint64]*pendingTrigger),
+	}
+	return client, tx, push, ipc.NewCodec(daemonConn), daemonConn
+}
+
+// Collect every event sent to a trigger until its stream is closed.
+func drain(t *testing.T, trigger ipc.Trigger) []ipc.Event {
+	t.Helper()
+	events := make([]ipc.Event, 0)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case batch, ok := <-trigger.Responder:
+			if !ok {
+				return events
+			}
+			events = append(events, batch...)
+		case <-timeout:
+			t.Fatal("response stream was not closed")
+		}
+	}
+}
+
+func TestClientFailsTriggersWhenTheConnectionIsLost(t *testing.T) {
+	client, tx, push, daemon, daemonConn := pipeClient()
+	go client.Run()
+
+	trigger := ipc.NewTrigger(context.Background(), ipc.Event{Component: ipc.COMPONENT_REGION_PICKER, Action: ipc.ACTION_LIST_REGIONS})
+	tx <- trigger
+	frame, err := daemon.Read()
+	if err != nil || frame.Kind != ipc.FRAME_TRIGGER {
+		t.Fatalf("daemon got frame %+v, %v, want the trigger", frame, err)
+	}
+	progress := ipc.Event{Component: ipc.COMPONENT_REGION_PICKER, Action: ipc.ACTION_PROGRESS, Data: ipc.ProgressData{Action: ipc.ACTION_LIST_REGIONS, Message: "Listing"}}
+	if err := daemon.Write(ipc.Frame{Kind: ipc.FRAME_EVENTS, Id: frame.Id, Events: []ipc.Event{progress}}); err != nil {
+		t.Fatal(err)
+	}
+	daemonConn.Close()
+
+	events := drain(t, trigger)
+	if len(events) != 2 || events[0].Action != ipc.ACTION_PROGRESS || events[1].Action != ipc.ACTION_FAILED {
+		t.Fatalf("got %+v, want the progress then a failed event", events)
+	}
+	select {
+	case pushed := <-push:
+		if len(pushed) != 2 || pushed[1].Action != ipc.ACTION_SHOW_ERROR_MESSAGE {
+			t.Errorf("got pushed %+v, want the lost connection error", pushed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lost connection was not reported")
+	}
+
+	// Later triggers fail right away
+	later := ipc.NewTrigger(context.Background(), ipc.Event{Component: ipc.COMPONENT_REGION_PICKER, Action: ipc.ACTION_LIST_REGIONS})
+	tx <- later
+	if events := drain(t, later); len(events) == 0 || events[0].Action != ipc.ACTION_FAILED {
+		t.Errorf("got %+v, want a failed event", events)
+	}
+}
+
+func TestPendingTriggerDropsEventsOnceClosed(t *testing.T) {
+	trigger := ipc.NewTrigger(context.Background(), ipc.Event{Component: ipc.COMPONENT_REGION_PICKER, Action: ipc.ACTION_LIST_REGIONS})
+	pending := &pendingTrigger{trigger: trigger}
+
+	// The reader loop and a failed write racing to answer the same trigger
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			pending.send([]ipc.Event{{Component: ipc.COMPONENT_REGION_PICKER, Action: ipc.ACTION_PROGRESS}})
+		}
+	}()
+	go pending.fail("write failed")
+	events := drain(t, trigger)
+	<-done
+
+	if len(events) == 0 || events[len(events)-1].Action != ipc.ACTION_FAILED {
+		t.Errorf("got %+v, want the failed event last", events)
+	}
+	pending.close() // Closing again is safe
+}
@@ -0,0 +1,288 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// DefaultSocketPath returns the socket the daemon listens on when none is given.
+// It lives in the user's runtime directory, or in a directory of the user in
+// the shared temporary directory, so other users can not reach or replace it.
+func DefaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, fmt.Sprintf("canopy-%d.sock", os.Getuid()))
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("canopy-%d", os.Getuid()), "canopy.sock")
+}
+
+// Create the directory of a socket if it does not exist, and make sure no
+// other user can create or replace a socket in it.
+func ensurePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return checkPrivateDir(dir)
+}
+
+func checkPrivateDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !ownedByUser(info) || info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s must be owned by the user and not writable by others to hold the canopy socket", dir)
+	}
+	return nil
+}
+
+// Make sure a socket was created by a daemon of the same user. Triggers carry
+// access keys and MFA codes, they must never reach another user's listener.
+func checkSocketOwner(socketPath string) error {
+	if err := checkPrivateDir(filepath.Dir(socketPath)); err != nil {
+		return err
+	}
+	info, err := os.Lstat(socketPath)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != os.ModeSocket || !ownedByUser(info) {
+		return fmt.Errorf("%s is not a socket owned by the user", socketPath)
+	}
+	return nil
+}
+
+// How many frames may wait to be written to a client before it is dropped
+const CLIENT_QUEUE_SIZE = 64
+
+// How long writing a frame to a client may take before it is dropped
+const CLIENT_WRITE_TIMEOUT = 5 * time.Second
+
+// A tui window attached to the daemon. Frames for it are queued and written
+// by its own goroutine, so a client that stops reading never blocks the others.
+type client struct {
+	conn        net.Conn
+	codec       *ipc.Codec
+	queue       chan ipc.Frame                // Frames waiting to be written
+	done        chan struct{}                 // Closed once the client detached
+	cancelsLock sync.Mutex                    // Protects cancels
+	cancels     map[uint64]context.CancelFunc // Cancel functions of the client's in flight triggers
+}
+
+// Queue a frame for the client. A client whose queue is full has fallen
+// behind and is dropped, reports whether the frame was queued.
+func (c *client) send(frame ipc.Frame) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.queue <- frame:
+		return true
+	default:
+		slog.Warn("Dropping client that fell behind", "queued", len(c.queue))
+		c.conn.Close() // The read loop fails and detaches the client
+		return false
+	}
+}
+
+// Write queued frames until the client detaches.
+func (c *client) writeFrames() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case frame := <-c.queue:
+			c.conn.SetWriteDeadline(time.Now().Add(CLIENT_WRITE_TIMEOUT))
+			if err := c.codec.Write(frame); err != nil {
+				slog.Warn("Dropping client that could not be written to", "error", err)
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// Daemon accepts tui clients on a unix socket and relays their triggers to a
+// backend.Server. Events the server pushes are sent to every client.
+type Daemon struct {
+	tx          *chan ipc.Trigger // Channel the backend server reads triggers from
+	push        *chan []ipc.Event // Channel the backend server pushes events on
+	socketPath  string
+	clientsLock sync.Mutex // Protects clients
+	clients     map[*client]struct{}
+}
+
+func NewDaemon(tx *chan ipc.Trigger, push *chan []ipc.Event, socketPath string) *Daemon {
+	return &Daemon{
+		tx:         tx,
+		push:       push,
+		socketPath: socketPath,
+		clients:    make(map[*client]struct{}),
+	}
+}
+
+// Serve accepts clients until ctx is done.
+func (d *Daemon) Serve(ctx context.Context) error {
+	if err := ensurePrivateDir(filepath.Dir(d.socketPath)); err != nil {
+		return err
+	}
+	if err := removeStaleSocket(d.socketPath); err != nil {
+		return err
+	}
+	listener, err := net.Listen("unix", d.socketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(d.socketPath)
+	if err := os.Chmod(d.socketPath, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+	slog.Info("Daemon is listening", "socket", d.socketPath)
+
+	go d.broadcast()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Daemon is shutting down")
+				return nil
+			}
+			return err
+		}
+		go d.handleClient(conn)
+	}
+}
+
+// Refuse to start if another daemon is listening, otherwise clean up the socket a dead one left behind.
+func removeStaleSocket(socketPath string) error {
+	if _, err := os.Stat(socketPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return fmt.Errorf("a canopy daemon is already listening on %s", socketPath)
+	}
+	return os.Remove(socketPath)
+}
+
+func (d *Daemon) handleClient(conn net.Conn) {
+	c := &client{
+		conn:    conn,
+		codec:   ipc.NewCodec(conn),
+		queue:   make(chan ipc.Frame, CLIENT_QUEUE_SIZE),
+		done:    make(chan struct{}),
+		cancels: make(map[uint64]context.CancelFunc),
+	}
+	go c.writeFrames()
+	d.clientsLock.Lock()
+	d.clients[c] = struct{}{}
+	d.clientsLock.Unlock()
+	slog.Info("Client attached")
+
+	defer func() {
+		d.clientsLock.Lock()
+		delete(d.clients, c)
+		d.clientsLock.Unlock()
+		close(c.done)
+		// Nobody is waiting for the answers anymore
+		c.cancelsLock.Lock()
+		for _, cancel := range c.cancels {
+			cancel()
+		}
+		c.cancelsLock.Unlock()
+		conn.Close()
+		slog.Info("Client detached")
+	}()
+
+	for {
+		frame, err := c.codec.Read()
+		if err != nil {
+			slog.Debug("Stopped reading from client", "error", err)
+			return
+		}
+		switch frame.Kind {
+		case ipc.FRAME_TRIGGER:
+			d.handleTriggerFrame(c, frame)
+		case ipc.FRAME_CANCEL:
+			c.cancelsLock.Lock()
+			if cancel, ok := c.cancels[frame.Id]; ok {
+				cancel()
+			}
+			c.cancelsLock.Unlock()
+		default:
+			slog.Warn("Ignoring unexpected frame from client", "kind", frame.Kind)
+		}
+	}
+}
+
+func (d *Daemon) handleTriggerFrame(c *client, frame ipc.Frame) {
+	if len(frame.Events) != 1 {
+		slog.Warn("Ignoring trigger frame without exactly one event", "id", frame.Id)
+		return
+	}
+	event := frame.Events[0]
+	if event.Component == ipc.COMPONENT_QUIT {
+		// A client quitting must not stop the daemon for everyone else
+		c.send(ipc.Frame{Kind: ipc.FRAME_CLOSE, Id: frame.Id})
+		return
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if frame.Deadline.IsZero() {
+		ctx, cancel = context.WithCancel(context.Background())
+	} else {
+		ctx, cancel = context.WithDeadline(context.Background(), frame.Deadline)
+	}
+	c.cancelsLock.Lock()
+	c.cancels[frame.Id] = cancel
+	c.cancelsLock.Unlock()
+
+	trigger := ipc.NewTrigger(ctx, event)
+	go d.relayResponses(c, frame.Id, trigger)
+	*d.tx <- trigger
+}
+
+// Relay every batch on the trigger's response stream to the client until the server closes it.
+func (d *Daemon) relayResponses(c *client, id uint64, trigger ipc.Trigger) {
+	for events := range trigger.Responder {
+		// Keep draining when the client went away so the handler is never blocked on it
+		c.send(ipc.Frame{Kind: ipc.FRAME_EVENTS, Id: id, Events: events})
+	}
+	c.send(ipc.Frame{Kind: ipc.FRAME_CLOSE, Id: id})
+
+	c.cancelsLock.Lock()
+	if cancel, ok := c.cancels[id]; ok {
+		cancel()
+		delete(c.cancels, id)
+	}
+	c.cancelsLock.Unlock()
+}
+
+// Queue every pushed batch for every attached client. Queueing never blocks,
+// so the backend publishing events is never held up by a client.
+func (d *Daemon) broadcast() {
+	for events := range *d.push {
+		d.clientsLock.Lock()
+		for c := range d.clients {
+			c.send(ipc.Frame{Kind: ipc.FRAME_PUSH, Events: events})
+		}
+		d.clientsLock.Unlock()
+	}
+}
@@ -0,0 +1,183 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/livinlefevreloca/canopy/internal/backend"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// A daemon without a socket, clients are attached to it with attachClient.
+func testDaemon() (*Daemon, chan ipc.Trigger, chan []ipc.Event) {
+	tx, push := make(chan ipc.Trigger), make(chan []ipc.Event)
+	return NewDaemon(&tx, &push, ""), tx, push
+}
+
+// Attach a client over a pipe and return the end the client reads and writes.
+func attachClient(t *testing.T, d *Daemon) net.Conn {
+	t.Helper()
+	clientConn, daemonConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	d.clientsLock.Lock()
+	attached := len(d.clients)
+	d.clientsLock.Unlock()
+	go d.handleClient(daemonConn)
+	waitForClients(t, d, attached+1)
+	return clientConn
+}
+
+func waitForClients(t *testing.T, d *Daemon, want int) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		d.clientsLock.Lock()
+		attached := len(d.clients)
+		d.clientsLock.Unlock()
+		if attached == want {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("got %d clients attached, want %d", attached, want)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestStalledClientDoesNotBlockPushes(t *testing.T) {
+	d, _, push := testDaemon()
+	go d.broadcast()
+	healthy := attachClient(t, d)
+	attachClient(t, d) // Never reads
+
+	received := make(chan struct{})
+	go func() {
+		codec := ipc.NewCodec(healthy)
+		for {
+			frame, err := codec.Read()
+			if err != nil {
+				return
+			}
+			if frame.Kind == ipc.FRAME_PUSH {
+				received <- struct{}{}
+			}
+		}
+	}()
+
+	// More pushes than the stalled client can queue, the healthy one keeps up
+	for range CLIENT_QUEUE_SIZE * 2 {
+		select {
+		case push <- ipc.ErrorEvents("pushed"):
+		case <-time.After(5 * time.Second):
+			t.Fatal("pushing blocked on the stalled client")
+		}
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the healthy client did not get the push")
+		}
+	}
+	waitForClients(t, d, 1) // The stalled client fell behind and was dropped
+}
+
+func TestSocketMustBelongToTheUser(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "canopy", "canopy.sock")
+	d, _, _ := testDaemon()
+	d.socketPath = socketPath
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- d.Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-served
+	})
+
+	// The daemon creates a private directory for the socket
+	for start := time.Now(); checkSocketOwner(socketPath) != nil; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("the daemon did not create its socket: %v", checkSocketOwner(socketPath))
+		}
+	}
+	if info, err := os.Stat(filepath.Dir(socketPath)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("got socket directory %v, %v, want mode 0700", info.Mode(), err)
+	}
+
+	// Not in a directory others can write to
+	shared := filepath.Join(dir, "shared")
+	if err := os.Mkdir(shared, 0700); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(shared, 0777)
+	if err := ensurePrivateDir(shared); err == nil {
+		t.Error("a directory everyone can write to was accepted for the socket")
+	}
+
+	// Not a file that is not a socket
+	file := filepath.Join(dir, "canopy", "file.sock")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocketOwner(file); err == nil {
+		t.Error("a regular file was accepted as the socket")
+	}
+
+	// Not a socket of another user
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner of the socket needs root")
+	}
+	if err := os.Lchown(socketPath, 12345, 12345); err != nil {
+		t.Fatal(err)
+	}
+	tx, push := make(chan ipc.Trigger), make(chan []ipc.Event)
+	if _, err := NewClient(&tx, &push, socketPath); err == nil {
+		t.Error("attached to a socket owned by another user")
+	}
+}
+
+func TestUnknownActionIsAnsweredWithoutDisconnecting(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("HOME", dir)
+	d, tx, push := testDaemon()
+	server := backend.NewServer(&tx, &push, "", "")
+	go server.Run()
+	go d.broadcast()
+	t.Cleanup(func() {
+		quit := ipc.NewTrigger(context.Background(), ipc.Event{Component: ipc.COMPONENT_QUIT, Action: ipc.ACTION_END})
+		tx <- quit
+		for range quit.Responder {
+		}
+	})
+	conn := attachClient(t, d)
+	codec := ipc.NewCodec(conn)
+
+	// An action of a newer tui the daemon does not know
+	unknown := ipc.Event{Component: ipc.COMPONENT_REGION_PICKER, Action: "listRegionsByLatency"}
+	if err := codec.Write(ipc.Frame{Kind: ipc.FRAME_TRIGGER, Id: 1, Events: []ipc.Event{unknown}}); err != nil {
+		t.Fatal(err)
+	}
+	want := (&backend.UnsupportedActionError{Component: unknown.Component, Action: unknown.Action}).Error()
+	events := make([]ipc.Event, 0)
+	for closed := false; !closed; {
+		frame, err := codec.Read()
+		if err != nil {
+			t.Fatalf("the daemon disconnected instead of answering: %v", err)
+		}
+		if frame.Id != 1 {
+			continue // A push
+		}
+		events = append(events, frame.Events...)
+		closed = frame.Kind == ipc.FRAME_CLOSE
+	}
+	if len(events) != 3 || events[0].Action != ipc.ACTION_FAILED || events[2].Data.(ipc.ErrorData).Message != want {
+		t.Errorf("got %+v, want the failed event and the %q error", events, want)
+	}
+	waitForClients(t, d, 1) // Still attached
+}
@@ -3,10 +3,25 @@ package ipc
 const (
 	// Request data about the current authentication state
 	ACTION_GET_AUTH_DATA             = "getAuthData"
+	ACTION_AUTH_CHANGED              = "authChanged"
+	ACTION_CREDENTIALS_EXPIRING      = "credentialsExpiring"
 	ACTION_REAUTHENTICATE_SSO        = "reauthenticateSSO"
 	ACTION_MUST_REAUTHENTICATE_SSO   = "mustReauthenticateSSO"
 	ACTION_FINISH_REAUTHENTICATE_SSO = "finishReauthenticateSSO"
+	ACTION_SSO_DEVICE_AUTHORIZATION  = "ssoDeviceAuthorization"
 	ACTION_CHANGE_PROFILE            = "changeProfile"
+	ACTION_SET_ACCESS_KEYS           = "reauthWithNewAccessKeys"
+	ACTION_ACCESS_KEYS_INVALID       = "accessKeysInvalid"
+	ACTION_ASSUME_ROLE               = "assumeRole"
+	ACTION_STEP_BACK_ROLE            = "stepBackRole" // Go back to the identity the current role was assumed from
+	ACTION_LIST_SSO_ACCOUNTS         = "listSSOAccounts"
+	ACTION_LIST_SSO_ROLES            = "listSSORoles"
+	ACTION_USE_SSO_ROLE              = "useSSORole"
+	ACTION_SAVE_SSO_PROFILE          = "saveSSOProfile"
+	ACTION_SAVE_CONFIG_SECTION       = "saveConfigSection"
+	ACTION_DELETE_CONFIG_SECTION     = "deleteConfigSection"
+	ACTION_CONFIG_SECTION_INVALID    = "configSectionInvalid"
+	ACTION_PROFILES_CHANGED          = "profilesChanged"
 
 	// Trigger the Tui component to show the error modal
 	ACTION_SHOW_ERROR_MODAL = "showErrorModal"
@@ -16,6 +31,29 @@ const (
 
 	// Show Reauthhenticate SSO modal
 	ACTION_SHOW_REAUTHENTICATE_SSO_MODAL = "showReauthenticateSSOModal"
+
+	// Status of the local credentials endpoint, and starting or stopping it
+	ACTION_GET_CREDENTIALS_SERVER    = "getCredentialsServer"
+	ACTION_TOGGLE_CREDENTIALS_SERVER = "toggleCredentialsServer"
+
+	// List the regions that can be switched to, and switch to one
+	ACTION_LIST_REGIONS  = "listRegions"
+	ACTION_CHANGE_REGION = "changeRegion"
+
+	// Ask the user for an MFA code in the middle of loading credentials, their
+	// answer, and the end of the prompt once it was answered or gave up waiting
+	ACTION_SHOW_MFA_MODAL    = "showMFAModal"
+	ACTION_REQUEST_MFA_TOKEN = "requestMFAToken"
+	ACTION_PROVIDE_MFA_TOKEN = "provideMFAToken"
+	ACTION_MFA_PROMPT_CLOSED = "mfaPromptClosed"
+
+	// Progress update for a trigger that is still running
+	ACTION_PROGRESS = "progress"
+
+	// Tell the component that sent a trigger it was cancelled, ran out of time or failed
+	ACTION_CANCELLED = "cancelled"
+	ACTION_TIMED_OUT = "timedOut"
+	ACTION_FAILED    = "failed"
 )
 
 const (
@@ -27,4 +65,6 @@ const (
 	ACTION_CLOSE_ERROR_MODAL              = "closeErrorModal"
 	ACTION_CLOSE_REAUTHENTICATE_SSO_MODAL = "closeReauthenticateSSOModal"
 	ACTION_CLOSE_AUTH_MODAL               = "closeAuthModal"
+	ACTION_CLOSE_MFA_MODAL                = "closeMFAModal"
+	ACTION_CLOSE_REGION_PICKER            = "closeRegionPicker"
 )
@@ -0,0 +1,84 @@
+package ipc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// How long a trigger may run before it times out, unless overridden below
+const DEFAULT_TRIGGER_TIMEOUT = 30 * time.Second
+
+// How long the backend waits for the user to enter an MFA code
+const MFA_PROMPT_TIMEOUT = 2 * time.Minute
+
+// Triggers that may have to wait for an MFA code get the time to enter it on top of the default
+const MFA_TRIGGER_TIMEOUT = MFA_PROMPT_TIMEOUT + DEFAULT_TRIGGER_TIMEOUT
+
+// Actions that are expected to take longer than the default, e.g. waiting on
+// the user in a browser. Every action that loads or uses credentials can run
+// into an MFA prompt, also while the config canopy started with is loading.
+var triggerTimeouts = map[string]time.Duration{
+	ACTION_REAUTHENTICATE_SSO: 5 * time.Minute,
+	ACTION_CHANGE_PROFILE:     MFA_TRIGGER_TIMEOUT,
+	ACTION_ASSUME_ROLE:        MFA_TRIGGER_TIMEOUT,
+	ACTION_SET_ACCESS_KEYS:    MFA_TRIGGER_TIMEOUT,
+	ACTION_GET_AUTH_DATA:      MFA_TRIGGER_TIMEOUT,
+	ACTION_LIST_REGIONS:       MFA_TRIGGER_TIMEOUT,
+	ACTION_CHANGE_REGION:      MFA_TRIGGER_TIMEOUT,
+}
+
+// TimeoutFor returns the deadline applied to triggers with the given action.
+func TimeoutFor(action string) time.Duration {
+	if timeout, ok := triggerTimeouts[action]; ok {
+		return timeout
+	}
+	return DEFAULT_TRIGGER_TIMEOUT
+}
+
+// TriggerHandle is returned to the sender of a trigger so it can abort it.
+type TriggerHandle struct {
+	cancel context.CancelFunc
+}
+
+// Cancel aborts the trigger. The backend answers with an ACTION_CANCELLED
+// event if the handler had not finished yet. Calling Cancel on a nil handle
+// or more than once is safe.
+func (h *TriggerHandle) Cancel() {
+	if h != nil {
+		h.cancel()
+	}
+}
+
+// CancelledEvents builds the event telling the component that sent a trigger
+// that it was cancelled or ran out of time.
+func CancelledEvents(trigger Trigger) []Event {
+	action := ACTION_CANCELLED
+	if errors.Is(trigger.Context.Err(), context.DeadlineExceeded) {
+		action = ACTION_TIMED_OUT
+	}
+	return []Event{{
+		Component: trigger.Component,
+		Action:    action,
+		Data: CancelledData{
+			Action: trigger.Action,
+		},
+	}}
+}
+
+// FailedEvents builds the event telling the component that sent a trigger that
+// its handler failed, so it can leave any progress it shows. The error itself
+// goes to the error modal. Components that never send triggers get none.
+func FailedEvents(trigger Trigger, message string) []Event {
+	if _, ok := eventPayloads[route{trigger.Component, ACTION_FAILED}]; !ok {
+		return nil
+	}
+	return []Event{{
+		Component: trigger.Component,
+		Action:    ACTION_FAILED,
+		Data: FailedData{
+			Action:  trigger.Action,
+			Message: message,
+		},
+	}}
+}
@@ -0,0 +1,27 @@
+package ipc
+
+// CoalescePolicy decides what happens to an event that is still queued for a
+// component when another event with the same action arrives.
+type CoalescePolicy int
+
+const (
+	// Every event is delivered in the order it was received, e.g. log lines or progress updates
+	COALESCE_DELIVER_ALL CoalescePolicy = iota
+	// Only the most recent event is delivered, e.g. a header refresh where older state is stale
+	COALESCE_LATEST_WINS
+)
+
+// Actions that do not deliver every event. Anything not listed here uses COALESCE_DELIVER_ALL.
+var coalescePolicies = map[string]CoalescePolicy{
+	ACTION_AUTH_CHANGED:     COALESCE_LATEST_WINS,
+	ACTION_PROFILES_CHANGED: COALESCE_LATEST_WINS,
+	ACTION_PROGRESS:         COALESCE_LATEST_WINS,
+}
+
+// CoalescePolicyFor returns the coalescing policy used for events with the given action.
+func CoalescePolicyFor(action string) CoalescePolicy {
+	if policy, ok := coalescePolicies[action]; ok {
+		return policy
+	}
+	return COALESCE_DELIVER_ALL
+}
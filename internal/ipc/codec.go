@@ -0,0 +1,168 @@
+package ipc
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Kinds of frames exchanged between a tui client and the daemon
+const (
+	FRAME_TRIGGER = "trigger" // client -> daemon: a new trigger
+	FRAME_CANCEL  = "cancel"  // client -> daemon: cancel an in flight trigger
+	FRAME_EVENTS  = "events"  // daemon -> client: a batch of events answering a trigger
+	FRAME_CLOSE   = "close"   // daemon -> client: the response stream of a trigger is closed
+	FRAME_PUSH    = "push"    // daemon -> client: events pushed by the backend without a trigger
+)
+
+// A Frame is a single message on the wire. Trigger frames carry the trigger
+// in Events[0], every other frame carries events or nothing.
+type Frame struct {
+	Kind     string
+	Id       uint64    // Id of the trigger the frame belongs to, 0 for pushes
+	Deadline time.Time // Deadline of a trigger, zero if it has none
+	Time     time.Time // When the frame was recorded, only set in recordings
+	Events   []Event
+}
+
+type wireEvent struct {
+	Component string          `json:"component"`
+	Action    string          `json:"action"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+}
+
+type wireFrame struct {
+	Kind     string      `json:"kind"`
+	Id       uint64      `json:"id,omitempty"`
+	Deadline *time.Time  `json:"deadline,omitempty"`
+	Time     *time.Time  `json:"time,omitempty"`
+	Events   []wireEvent `json:"events,omitempty"`
+}
+
+// Codec reads and writes newline delimited JSON frames. The payload of each
+// event is decoded into the type registered for its Component/Action pair, so
+// the receiving side gets the same typed Data the sender had.
+// Writes are safe to call from multiple goroutines, reads are not.
+type Codec struct {
+	writeLock sync.Mutex
+	writer    io.Writer
+	reader    *bufio.Reader
+}
+
+func NewCodec(rw io.ReadWriter) *Codec {
+	return &Codec{
+		writer: rw,
+		reader: bufio.NewReader(rw),
+	}
+}
+
+// Write encodes a frame and writes it as a single line.
+func (c *Codec) Write(frame Frame) error {
+	wire := wireFrame{
+		Kind:   frame.Kind,
+		Id:     frame.Id,
+		Events: make([]wireEvent, 0, len(frame.Events)),
+	}
+	if !frame.Deadline.IsZero() {
+		wire.Deadline = &frame.Deadline
+	}
+	if !frame.Time.IsZero() {
+		wire.Time = &frame.Time
+	}
+	for _, event := range frame.Events {
+		encoded, err := encodeEvent(event)
+		if err != nil {
+			return err
+		}
+		wire.Events = append(wire.Events, encoded)
+	}
+	line, err := json.Marshal(wire)
+	if err != nil {
+		return err
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	_, err = c.writer.Write(append(line, '\n'))
+	return err
+}
+
+// Read blocks until a full frame is available and decodes it.
+func (c *Codec) Read() (Frame, error) {
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return Frame{}, err
+	}
+	var wire wireFrame
+	if err := json.Unmarshal(line, &wire); err != nil {
+		return Frame{}, err
+	}
+	frame := Frame{
+		Kind:   wire.Kind,
+		Id:     wire.Id,
+		Events: make([]Event, 0, len(wire.Events)),
+	}
+	if wire.Deadline != nil {
+		frame.Deadline = *wire.Deadline
+	}
+	if wire.Time != nil {
+		frame.Time = *wire.Time
+	}
+	// Triggers are decoded with the trigger payloads, everything else with the event payloads
+	registry := eventPayloads
+	if wire.Kind == FRAME_TRIGGER {
+		registry = triggerPayloads
+	}
+	for _, encoded := range wire.Events {
+		event, err := decodeEvent(registry, encoded)
+		if err != nil {
+			return Frame{}, err
+		}
+		frame.Events = append(frame.Events, event)
+	}
+	return frame, nil
+}
+
+// encodeEvent converts an event to its wire form.
+func encodeEvent(event Event) (wireEvent, error) {
+	encoded := wireEvent{
+		Component: event.Component,
+		Action:    event.Action,
+		RequestID: event.RequestID,
+	}
+	if event.Data != nil {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return encoded, err
+		}
+		encoded.Data = data
+	}
+	return encoded, nil
+}
+
+// decodeEvent converts an event from its wire form. An event for a pair with
+// no payload registered is decoded without its Data rather than failing the
+// whole frame, the receiver rejects it like any other unknown event. A peer
+// built from another version must not lose its connection over one action.
+func decodeEvent(registry map[route]reflect.Type, encoded wireEvent) (Event, error) {
+	event := Event{
+		Component: encoded.Component,
+		Action:    encoded.Action,
+		RequestID: encoded.RequestID,
+	}
+	payload, ok := registry[route{encoded.Component, encoded.Action}]
+	if !ok || payload == nil {
+		return event, nil
+	}
+	data := reflect.New(payload)
+	if len(encoded.Data) > 0 {
+		if err := json.Unmarshal(encoded.Data, data.Interface()); err != nil {
+			return event, err
+		}
+	}
+	event.Data = data.Elem().Interface()
+	return event, nil
+}
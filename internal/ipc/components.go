@@ -5,6 +5,9 @@ const (
 	COMPONENT_AUTH_MODAL      = "AuthModal"
 	COMPONENT_CHANGE_PROFILE  = "ChangeProfileView"
 	COMPONENT_SET_ACCESS_KEYS = "SetAccessKeysView"
+	COMPONENT_ASSUME_ROLE     = "AssumeRoleView"
+	COMPONENT_SSO_BROWSER     = "SSOBrowserView"
+	COMPONENT_PROFILE_EDITOR  = "ProfileEditorView"
 
 	// Error modal name
 	COMPONENT_ERROR_MODAL = "ErrorModal"
@@ -17,6 +20,15 @@ const (
 	// Help modal name
 	COMPONENT_HELP_MODAL = "HelpModal"
 
+	// Modal controlling the local credentials endpoint
+	COMPONENT_CREDENTIALS_SERVER = "CredentialsServerModal"
+
+	// Modal switching the region of the active identity
+	COMPONENT_REGION_PICKER = "RegionPickerModal"
+
+	// Modal asking for the code of an MFA device
+	COMPONENT_MFA_MODAL = "MFAModal"
+
 	// Refresh SSO modal name
 	COMPONENT_REFRESH_SSO = "SSOReauthenticationModal"
 
@@ -1,19 +1,96 @@
 package ipc
 
+import "time"
+
 type AWSConfigData struct {
 	Profile           string
+	AuthType          string // How the profile gets its credentials, see auth.AuthType
 	SSORoleName       string
 	AccountId         string
 	AssumeRoleARN     string
 	AccessKeyID       string
 	CredentialsSource string
 	Region            string
+	RoleChain         []string  // Identities the current role was assumed from, the first is the original identity
+	Expires           time.Time // When the credentials expire, zero if they do not
 }
 
 type AWSAccessKeysData struct {
 	AccessKeyID     string
 	SecretAccessKey string
+	SessionToken    string // Only set for temporary keys
 	Region          string
+	SaveAsProfile   string // Save the keys to the credentials file under this profile, empty to only use them
+}
+
+type AssumeRoleData struct {
+	RoleARN         string
+	SessionName     string
+	DurationSeconds int32  // 0 uses the role's default
+	ExternalID      string // Optional
+}
+
+type SSOSessionData struct {
+	Session string // Name of the sso-session, or the start URL of legacy SSO profiles
+}
+
+type SSOAccountData struct {
+	AccountID string
+	Name      string
+	Email     string
+}
+
+type SSOAccountsData struct {
+	Session  string
+	Accounts []SSOAccountData
+}
+
+type SSORolesData struct {
+	Session   string
+	AccountID string
+	Roles     []string
+}
+
+// A role of an SSO account, and the profile to save it as.
+type SSORoleData struct {
+	Session   string
+	AccountID string
+	RoleName  string // Empty when listing the roles of the account
+	Profile   string // Only used when saving the role as a profile
+}
+
+// Pushed when the current credentials are about to expire and cannot be refreshed without the user.
+type CredentialsExpiringData struct {
+	Identity string // Who the expiring credentials act as
+	Expires  time.Time
+}
+
+// A profile or sso-session block of the AWS config file.
+type ConfigSectionData struct {
+	Kind       string // "profile" or "sso-session"
+	Name       string
+	Original   string // Name of the section being edited, empty to add a new one
+	Properties []ConfigPropertyData
+}
+
+type ConfigPropertyData struct {
+	Key   string
+	Value string
+}
+
+type RegionData struct {
+	Name  string
+	OptIn bool // The region is disabled by default and was enabled for the account
+}
+
+type RegionsData struct {
+	Current string // Region of the active identity
+	Regions []RegionData
+	Offline string // Why the enabled regions could not be listed, empty if they were
+}
+
+type ChangeRegionData struct {
+	Region string
 }
 
 type ChangeProfileData struct {
@@ -29,6 +106,49 @@ type ReauthenticateSSOData struct {
 	Profile string
 }
 
+// What the user has to do in a browser to approve an SSO login.
+type SSODeviceAuthorizationData struct {
+	VerificationURI         string
+	VerificationURIComplete string // VerificationURI with the user code filled in
+	UserCode                string
+	ExpiresAt               time.Time
+}
+
+type CredentialsServerData struct {
+	Running bool
+	URL     string // Value for AWS_CONTAINER_CREDENTIALS_FULL_URI
+	Token   string // Value for AWS_CONTAINER_AUTHORIZATION_TOKEN
+}
+
+type MFARequestData struct {
+	PromptID     string // Identifies the prompt the answer is for
+	SerialNumber string // The MFA device to enter a code of
+}
+
+type MFAPromptClosedData struct {
+	PromptID string // The prompt that is no longer waiting for a code
+}
+
+type MFATokenData struct {
+	PromptID  string
+	Token     string
+	Cancelled bool // The user closed the prompt without entering a code
+}
+
 type ErrorData struct {
 	Message string
 }
+
+type CancelledData struct {
+	Action string // The action of the trigger that was cancelled
+}
+
+type FailedData struct {
+	Action  string // The action of the trigger that failed
+	Message string // The error, also shown in the error modal
+}
+
+type ProgressData struct {
+	Action  string // The action of the trigger that is making progress
+	Message string
+}
@@ -0,0 +1,196 @@
+package ipc
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A route identifies a Component/Action pair.
+type route struct {
+	component string
+	action    string
+}
+
+// The payload registry. Each Component/Action pair declares the type of the
+// Data it carries. Triggers (tui -> backend) and events (backend -> tui or
+// component -> component) are registered separately because the same pair is
+// often used for both directions with different payloads, e.g. the
+// ChangeProfileView sends ChangeProfileData and gets an empty event back.
+// A nil type means the pair carries no payload.
+var triggerPayloads = map[route]reflect.Type{
+	{COMPONENT_HEADER, ACTION_GET_AUTH_DATA}:                         nil,
+	{COMPONENT_CHANGE_PROFILE, ACTION_CHANGE_PROFILE}:                reflect.TypeFor[ChangeProfileData](),
+	{COMPONENT_SET_ACCESS_KEYS, ACTION_SET_ACCESS_KEYS}:              reflect.TypeFor[AWSAccessKeysData](),
+	{COMPONENT_ASSUME_ROLE, ACTION_ASSUME_ROLE}:                      reflect.TypeFor[AssumeRoleData](),
+	{COMPONENT_ASSUME_ROLE, ACTION_STEP_BACK_ROLE}:                   nil,
+	{COMPONENT_SSO_BROWSER, ACTION_LIST_SSO_ACCOUNTS}:                reflect.TypeFor[SSOSessionData](),
+	{COMPONENT_SSO_BROWSER, ACTION_LIST_SSO_ROLES}:                   reflect.TypeFor[SSORoleData](),
+	{COMPONENT_SSO_BROWSER, ACTION_USE_SSO_ROLE}:                     reflect.TypeFor[SSORoleData](),
+	{COMPONENT_SSO_BROWSER, ACTION_SAVE_SSO_PROFILE}:                 reflect.TypeFor[SSORoleData](),
+	{COMPONENT_PROFILE_EDITOR, ACTION_SAVE_CONFIG_SECTION}:           reflect.TypeFor[ConfigSectionData](),
+	{COMPONENT_PROFILE_EDITOR, ACTION_DELETE_CONFIG_SECTION}:         reflect.TypeFor[ConfigSectionData](),
+	{COMPONENT_REFRESH_SSO, ACTION_REAUTHENTICATE_SSO}:               reflect.TypeFor[ReauthenticateSSOData](),
+	{COMPONENT_MFA_MODAL, ACTION_PROVIDE_MFA_TOKEN}:                  reflect.TypeFor[MFATokenData](),
+	{COMPONENT_REGION_PICKER, ACTION_LIST_REGIONS}:                   nil,
+	{COMPONENT_REGION_PICKER, ACTION_CHANGE_REGION}:                  reflect.TypeFor[ChangeRegionData](),
+	{COMPONENT_CREDENTIALS_SERVER, ACTION_GET_CREDENTIALS_SERVER}:    nil,
+	{COMPONENT_CREDENTIALS_SERVER, ACTION_TOGGLE_CREDENTIALS_SERVER}: nil,
+	{COMPONENT_QUIT, ACTION_END}:                                     nil,
+}
+
+var eventPayloads = map[route]reflect.Type{
+	{TOPIC_AUTH_CHANGED, ACTION_AUTH_CHANGED}:                        reflect.TypeFor[AWSConfigData](),
+	{TOPIC_PROFILES_CHANGED, ACTION_PROFILES_CHANGED}:                nil,
+	{COMPONENT_HEADER, ACTION_CREDENTIALS_EXPIRING}:                  reflect.TypeFor[CredentialsExpiringData](),
+	{COMPONENT_CHANGE_PROFILE, ACTION_CHANGE_PROFILE}:                nil,
+	{COMPONENT_SET_ACCESS_KEYS, ACTION_SET_ACCESS_KEYS}:              nil,
+	{COMPONENT_SET_ACCESS_KEYS, ACTION_ACCESS_KEYS_INVALID}:          reflect.TypeFor[ErrorData](),
+	{COMPONENT_ASSUME_ROLE, ACTION_ASSUME_ROLE}:                      nil,
+	{COMPONENT_ASSUME_ROLE, ACTION_STEP_BACK_ROLE}:                   nil,
+	{COMPONENT_SSO_BROWSER, ACTION_LIST_SSO_ACCOUNTS}:                reflect.TypeFor[SSOAccountsData](),
+	{COMPONENT_SSO_BROWSER, ACTION_LIST_SSO_ROLES}:                   reflect.TypeFor[SSORolesData](),
+	{COMPONENT_SSO_BROWSER, ACTION_USE_SSO_ROLE}:                     nil,
+	{COMPONENT_SSO_BROWSER, ACTION_SAVE_SSO_PROFILE}:                 reflect.TypeFor[SSORoleData](),
+	{COMPONENT_PROFILE_EDITOR, ACTION_SAVE_CONFIG_SECTION}:           reflect.TypeFor[ConfigSectionData](),
+	{COMPONENT_PROFILE_EDITOR, ACTION_DELETE_CONFIG_SECTION}:         reflect.TypeFor[ConfigSectionData](),
+	{COMPONENT_PROFILE_EDITOR, ACTION_CONFIG_SECTION_INVALID}:        reflect.TypeFor[ErrorData](),
+	{COMPONENT_REFRESH_SSO, ACTION_MUST_REAUTHENTICATE_SSO}:          nil,
+	{COMPONENT_REFRESH_SSO, ACTION_FINISH_REAUTHENTICATE_SSO}:        nil,
+	{COMPONENT_REFRESH_SSO, ACTION_SSO_DEVICE_AUTHORIZATION}:         reflect.TypeFor[SSODeviceAuthorizationData](),
+	{COMPONENT_ERROR_MODAL, ACTION_SHOW_ERROR_MESSAGE}:               reflect.TypeFor[ErrorData](),
+	{COMPONENT_TUI, ACTION_SHOW_ERROR_MODAL}:                         nil,
+	{COMPONENT_TUI, ACTION_CLOSE_ERROR_MODAL}:                        nil,
+	{COMPONENT_TUI, ACTION_SHOW_REAUTHENTICATE_SSO_MODAL}:            nil,
+	{COMPONENT_TUI, ACTION_CLOSE_REAUTHENTICATE_SSO_MODAL}:           nil,
+	{COMPONENT_TUI, ACTION_CLOSE_AUTH_MODAL}:                         nil,
+	{COMPONENT_TUI, ACTION_SHOW_MFA_MODAL}:                           nil,
+	{COMPONENT_TUI, ACTION_CLOSE_MFA_MODAL}:                          nil,
+	{COMPONENT_TUI, ACTION_CLOSE_REGION_PICKER}:                      nil,
+	{COMPONENT_MFA_MODAL, ACTION_REQUEST_MFA_TOKEN}:                  reflect.TypeFor[MFARequestData](),
+	{COMPONENT_MFA_MODAL, ACTION_PROVIDE_MFA_TOKEN}:                  nil,
+	{COMPONENT_MFA_MODAL, ACTION_MFA_PROMPT_CLOSED}:                  reflect.TypeFor[MFAPromptClosedData](),
+	{COMPONENT_REGION_PICKER, ACTION_LIST_REGIONS}:                   reflect.TypeFor[RegionsData](),
+	{COMPONENT_REGION_PICKER, ACTION_CHANGE_REGION}:                  nil,
+	{COMPONENT_CREDENTIALS_SERVER, ACTION_GET_CREDENTIALS_SERVER}:    reflect.TypeFor[CredentialsServerData](),
+	{COMPONENT_CREDENTIALS_SERVER, ACTION_TOGGLE_CREDENTIALS_SERVER}: reflect.TypeFor[CredentialsServerData](),
+	{COMPONENT_QUIT, ACTION_END}:                                     nil,
+}
+
+// Events that can be sent back to any component that sends triggers
+var triggerStreamPayloads = map[string]reflect.Type{
+	ACTION_PROGRESS:  reflect.TypeFor[ProgressData](),
+	ACTION_CANCELLED: reflect.TypeFor[CancelledData](),
+	ACTION_TIMED_OUT: reflect.TypeFor[CancelledData](),
+	ACTION_FAILED:    reflect.TypeFor[FailedData](),
+}
+
+func init() {
+	for r := range triggerPayloads {
+		if r.component == COMPONENT_QUIT {
+			continue
+		}
+		for action, payload := range triggerStreamPayloads {
+			eventPayloads[route{r.component, action}] = payload
+		}
+	}
+}
+
+// PayloadError is returned when the Data of an event does not match the
+// payload registered for its Component/Action pair.
+type PayloadError struct {
+	Component string
+	Action    string
+	Expected  reflect.Type // nil if no payload was expected
+	Got       reflect.Type // nil if no payload was sent
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("invalid payload for %s/%s: expected %s, got %s",
+		e.Component, e.Action, typeName(e.Expected), typeName(e.Got))
+}
+
+// UnregisteredRouteError is returned when a Component/Action pair has no payload registered.
+type UnregisteredRouteError struct {
+	Component string
+	Action    string
+}
+
+func (e *UnregisteredRouteError) Error() string {
+	return fmt.Sprintf("no payload registered for %s/%s", e.Component, e.Action)
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "no payload"
+	}
+	return t.String()
+}
+
+func validate(registry map[route]reflect.Type, event Event) error {
+	expected, ok := registry[route{event.Component, event.Action}]
+	if !ok {
+		return &UnregisteredRouteError{Component: event.Component, Action: event.Action}
+	}
+	got := reflect.TypeOf(event.Data)
+	if got != expected {
+		return &PayloadError{Component: event.Component, Action: event.Action, Expected: expected, Got: got}
+	}
+	return nil
+}
+
+// ValidateTrigger checks the Data of a trigger against the registered payload.
+func ValidateTrigger(event Event) error {
+	return validate(triggerPayloads, event)
+}
+
+// ValidateEvent checks the Data of an event against the registered payload.
+func ValidateEvent(event Event) error {
+	return validate(eventPayloads, event)
+}
+
+// Send validates the payload against the registry and hands the trigger to the backend.
+// Nothing is sent if validation fails.
+func Send[T any](r *TriggerHandler, component string, action string, data T) (*TriggerHandle, error) {
+	event := Event{
+		Component: component,
+		Action:    action,
+		Data:      data,
+	}
+	if err := ValidateTrigger(event); err != nil {
+		return nil, err
+	}
+	return r.MakeTrigger(event), nil
+}
+
+// Handle extracts the payload of an event as a T. It returns a PayloadError
+// instead of panicking when the Data is of a different type.
+func Handle[T any](event *Event) (T, error) {
+	data, ok := event.Data.(T)
+	if !ok {
+		return data, &PayloadError{
+			Component: event.Component,
+			Action:    event.Action,
+			Expected:  reflect.TypeFor[T](),
+			Got:       reflect.TypeOf(event.Data),
+		}
+	}
+	return data, nil
+}
+
+// ErrorEvents builds the event pair that opens the error modal and shows the message in it.
+func ErrorEvents(message string) []Event {
+	return []Event{
+		{
+			Component: COMPONENT_TUI,
+			Action:    ACTION_SHOW_ERROR_MODAL,
+			Data:      nil,
+		},
+		{
+			Component: COMPONENT_ERROR_MODAL,
+			Action:    ACTION_SHOW_ERROR_MESSAGE,
+			Data: ErrorData{
+				Message: message,
+			},
+		},
+	}
+}
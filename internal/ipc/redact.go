@@ -0,0 +1,83 @@
+package ipc
+
+import "strings"
+
+// Replaces secrets that should not be kept at all
+const REDACTED = "<redacted>"
+
+// A payload that holds secrets implements Redactor so it can be written
+// somewhere persistent, like a recording, without leaking them. Redacted must
+// return a value of the same type with the secrets masked.
+type Redactor interface {
+	Redacted() any
+}
+
+// Redact returns a copy of the events with every secret masked.
+func Redact(events []Event) []Event {
+	redacted := make([]Event, 0, len(events))
+	for _, event := range events {
+		if redactor, ok := event.Data.(Redactor); ok {
+			event.Data = redactor.Redacted()
+		}
+		redacted = append(redacted, event)
+	}
+	return redacted
+}
+
+// Mask a secret, keeping the last few characters of identifiers that are useful when debugging.
+func mask(value string, keep int) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= keep {
+		return strings.Repeat("*", len(value))
+	}
+	return strings.Repeat("*", len(value)-keep) + value[len(value)-keep:]
+}
+
+func (d AWSConfigData) Redacted() any {
+	d.AccessKeyID = mask(d.AccessKeyID, 4)
+	return d
+}
+
+func (d AssumeRoleData) Redacted() any {
+	d.ExternalID = mask(d.ExternalID, 0)
+	return d
+}
+
+func (d CredentialsServerData) Redacted() any {
+	d.Token = mask(d.Token, 0)
+	return d
+}
+
+func (d MFATokenData) Redacted() any {
+	d.Token = mask(d.Token, 0)
+	return d
+}
+
+func (d AWSAccessKeysData) Redacted() any {
+	d.AccessKeyID = mask(d.AccessKeyID, 4)
+	d.SecretAccessKey = REDACTED
+	if d.SessionToken != "" {
+		d.SessionToken = REDACTED
+	}
+	return d
+}
+
+// Settings that hold secrets, the config file may have access keys in it too
+var secretSettings = map[string]bool{
+	"aws_secret_access_key": true,
+	"aws_session_token":     true,
+}
+
+func (d ConfigSectionData) Redacted() any {
+	properties := make([]ConfigPropertyData, 0, len(d.Properties))
+	for _, property := range d.Properties {
+		if secretSettings[property.Key] {
+			property.Value = REDACTED
+		}
+		properties = append(properties, property)
+	}
+	d.Properties = properties
+	return d
+}
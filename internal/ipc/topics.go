@@ -0,0 +1,73 @@
+package ipc
+
+import (
+	"slices"
+	"sync"
+)
+
+// Topics carry events that any number of components may want. Events are
+// delivered to every subscriber of the topic named by their Component field.
+// Every component name is a topic as well, with the component as its only
+// subscriber, so events addressed to a single component take the same path.
+const (
+	// The active AWS identity or its details changed. Data is AWSConfigData
+	TOPIC_AUTH_CHANGED = "auth.changed"
+	// Profiles or sso-sessions were added, changed or removed. There is no Data
+	TOPIC_PROFILES_CHANGED = "profiles.changed"
+)
+
+type SubscriptionID uint64
+
+type subscription[T any] struct {
+	id         SubscriptionID
+	subscriber T
+}
+
+// Subscriptions maps topics to their subscribers. Subscribers can be added and
+// removed at any time, e.g. as views are opened and closed.
+type Subscriptions[T any] struct {
+	lock   sync.RWMutex                 // Protects topics and nextId
+	topics map[string][]subscription[T] // Subscribers of each topic in the order they subscribed
+	nextId SubscriptionID
+}
+
+func NewSubscriptions[T any]() *Subscriptions[T] {
+	return &Subscriptions[T]{
+		topics: make(map[string][]subscription[T]),
+		nextId: 0,
+	}
+}
+
+// Subscribe adds a subscriber to a topic. The returned id is used to unsubscribe.
+func (s *Subscriptions[T]) Subscribe(topic string, subscriber T) SubscriptionID {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nextId++
+	s.topics[topic] = append(s.topics[topic], subscription[T]{id: s.nextId, subscriber: subscriber})
+	return s.nextId
+}
+
+// Unsubscribe removes a subscription. Unknown ids are ignored.
+func (s *Subscriptions[T]) Unsubscribe(id SubscriptionID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for topic, subs := range s.topics {
+		s.topics[topic] = slices.DeleteFunc(subs, func(sub subscription[T]) bool {
+			return sub.id == id
+		})
+		if len(s.topics[topic]) == 0 {
+			delete(s.topics, topic)
+		}
+	}
+}
+
+// Subscribers returns the current subscribers of a topic.
+func (s *Subscriptions[T]) Subscribers(topic string) []T {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	subscribers := make([]T, 0, len(s.topics[topic]))
+	for _, sub := range s.topics[topic] {
+		subscribers = append(subscribers, sub.subscriber)
+	}
+	return subscribers
+}
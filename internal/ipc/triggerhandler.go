@@ -1,93 +1,226 @@
 package ipc
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
+
+	"github.com/livinlefevreloca/canopy/internal/logging"
 )
 
 type Event struct {
 	Component string      // The component to send the update to
 	Action    string      // The action to be performed by the component
 	Data      interface{} // Data to be sent back to the component
+	RequestID string      // Id of the trigger the event was produced for, empty if there was none
 }
 
+// A Trigger is a request from the tui to the backend. The backend answers on the
+// Responder, which is a stream: it can send any number of event batches
+// (progress, partial results, the final result) and then closes the Responder
+// to tell the triggerer nothing else is coming.
 type Trigger struct {
 	Event
-	Responder chan []Event // A channel to send the event back to the triggerer
+	Responder chan []Event    // A stream of event batches sent back to the triggerer
+	Context   context.Context // Cancelled when the triggerer aborts the trigger or its deadline passes
 }
 
-func NewTrigger(event Event) Trigger {
+// NewTrigger creates a trigger for the event. The event keeps its request id
+// if it has one, so a trigger relayed between processes can still be found in
+// the logs of both.
+func NewTrigger(ctx context.Context, event Event) Trigger {
+	if event.RequestID == "" {
+		event.RequestID = NewRequestID()
+	}
 	return Trigger{
-		Event:     event,                 // Initialize the Event part of the Trigger
-		Responder: make(chan []Event, 1), // Buffered channel for event
+		Event:     event,                  // Initialize the Event part of the Trigger
+		Responder: make(chan []Event, 10), // Buffered channel for event batches
+		Context:   ctx,
+	}
+}
+
+// NewRequestID returns a random id that is short enough for a user to quote.
+func NewRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Progress sends a progress update for the trigger to the component that sent it.
+func (t Trigger) Progress(message string) {
+	t.Respond(Event{
+		Component: t.Component,
+		Action:    ACTION_PROGRESS,
+		Data: ProgressData{
+			Action:  t.Action,
+			Message: message,
+		},
+	})
+}
+
+// Respond sends a batch of events to the triggerer, tagged with the trigger's request id.
+func (t Trigger) Respond(events ...Event) {
+	tagged := make([]Event, len(events))
+	for i, event := range events {
+		event.RequestID = t.RequestID
+		tagged[i] = event
 	}
+	t.Responder <- tagged
+}
+
+// Close ends the response stream. Nothing may be sent after it is closed.
+func (t Trigger) Close() {
+	close(t.Responder)
 }
 
+// TriggerHandler delivers events to the tui. Every responder gets a goroutine
+// that forwards its events onto a single inbox channel, so the tui only has
+// to block on one channel to wait for anything and uses no cpu while idle.
+// Events from a single responder arrive in the order they were sent.
 type TriggerHandler struct {
 	tx         *chan Trigger
-	responders []chan []Event    // A FIFO Queue for event channels using a channel
-	eventLock  sync.Mutex        // Mutex to protect access to the queues
-	events     map[string]*Event // A map of queues for each component
-	hasEvents  bool              // Flag to indicate if any event was received
-}
-
-func NewTriggerHandler(tx *chan Trigger) *TriggerHandler {
-	return &TriggerHandler{
-		tx:         tx,
-		responders: make([]chan []Event, 0),
-		eventLock:  sync.Mutex{},
-		events:     make(map[string]*Event),
-		hasEvents:  false,
+	ctxLock    sync.Mutex         // Protects ctx and cancel
+	ctx        context.Context    // Parent of the context of every trigger sent
+	cancel     context.CancelFunc // Cancels every outstanding trigger
+	inbox      chan []Event       // Fan in channel for events from every responder and component
+	responders atomic.Int64       // Number of responders that have not been closed yet
+	eventLock  sync.Mutex         // Mutex to protect access to the queues
+	events     map[string][]Event // A FIFO queue of events for each component
+	hasEvents  bool               // Flag to indicate if any event was received
+}
+
+// Create a TriggerHandler that sends triggers on tx. Events the backend
+// publishes on push without a trigger are delivered like any response.
+func NewTriggerHandler(tx *chan Trigger, push *chan []Event) *TriggerHandler {
+	r := &TriggerHandler{
+		tx:        tx,
+		inbox:     make(chan []Event, 100),
+		eventLock: sync.Mutex{},
+		events:    make(map[string][]Event),
+		hasEvents: false,
 	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	go r.forwardPush(push)
+	return r
 }
 
-func (r *TriggerHandler) MakeTrigger(event Event) {
-	trigger := NewTrigger(event)
-	responder := make(chan []Event, 1)
-	trigger.Responder = responder
+// MakeTrigger sends a trigger to the backend with the deadline for its action.
+// The returned handle can be used to cancel it.
+func (r *TriggerHandler) MakeTrigger(event Event) *TriggerHandle {
+	r.ctxLock.Lock()
+	ctx, cancel := context.WithTimeout(r.ctx, TimeoutFor(event.Action))
+	r.ctxLock.Unlock()
+	event.RequestID = NewRequestID()
+	trigger := NewTrigger(logging.WithRequestID(ctx, event.RequestID), event)
+	slog.DebugContext(trigger.Context, "Sending trigger", "component", event.Component, "action", event.Action)
+	r.responders.Add(1)
+	go r.forward(trigger, cancel)
 	*r.tx <- trigger
-	r.responders = append(r.responders, responder)
+	return &TriggerHandle{cancel: cancel}
+}
+
+// CancelOutstanding cancels every trigger that has been sent and not been
+// answered yet. Triggers sent afterwards are not affected.
+func (r *TriggerHandler) CancelOutstanding() {
+	r.ctxLock.Lock()
+	defer r.ctxLock.Unlock()
+	slog.Info("Cancelling outstanding triggers", "outstanding", r.responders.Load())
+	r.cancel()
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+}
+
+// Outstanding returns the number of triggers whose response stream is still open.
+func (r *TriggerHandler) Outstanding() int64 {
+	return r.responders.Load()
+}
+
+// Forward every batch from a responder onto the inbox. The responder stays
+// registered until the backend closes it.
+func (r *TriggerHandler) forward(trigger Trigger, cancel context.CancelFunc) {
+	defer r.responders.Add(-1)
+	defer cancel() // Release the deadline once the stream is closed
+	for events := range trigger.Responder {
+		for i := range events {
+			if events[i].RequestID == "" {
+				events[i].RequestID = trigger.RequestID // Sent without Respond
+			}
+		}
+		r.inbox <- events
+	}
+}
+
+// Forward events pushed by the backend onto the inbox.
+func (r *TriggerHandler) forwardPush(push *chan []Event) {
+	for events := range *push {
+		slog.Debug("Received pushed events", "count", len(events))
+		r.inbox <- events
+	}
 }
 
 // A function that can be used by one component to pass an event to another component.
 func (r *TriggerHandler) PassEvent(event Event) {
-	r.routeEvent(event) // Route the event to the appropriate queue
+	r.inbox <- []Event{event} // Go through the inbox so a waiting RecieveEvents wakes up
 }
 
 func (r *TriggerHandler) routeEvent(event Event) {
-	r.eventLock.Lock() // Lock the mutex to protect access to event slots
+	if err := ValidateEvent(event); err != nil {
+		// Never hand a component a payload it cannot handle. Show the error instead.
+		slog.Error("Dropping event with invalid payload", "component", event.Component, "action", event.Action, "requestId", event.RequestID, "error", err)
+		for _, errorEvent := range ErrorEvents(err.Error()) {
+			errorEvent.RequestID = event.RequestID
+			r.routeEvent(errorEvent)
+		}
+		return
+	}
+	r.eventLock.Lock() // Lock the mutex to protect access to the queues
 	defer r.eventLock.Unlock()
-	// Override any existing event for the component. If it hasnt been taken yet we want to skip it anyway.
-	r.events[event.Component] = &event
+	queue := r.events[event.Component]
+	if CoalescePolicyFor(event.Action) == COALESCE_LATEST_WINS {
+		// Drop any older event for the same action that hasnt been taken yet
+		queue = slices.DeleteFunc(queue, func(queued Event) bool {
+			return queued.Action == event.Action
+		})
+	}
+	r.events[event.Component] = append(queue, event)
 	r.hasEvents = true // Set the flag to true indicating a event was received
 }
 
+// RecieveEvents blocks until at least one batch of events is available and routes
+// it to the component queues. Any other batches that are already waiting are
+// routed as well so they can be rendered together.
 func (r *TriggerHandler) RecieveEvents() {
-	slog.Debug("Checking for events from responders", "responders", len(r.responders))
-	remainingResponders := make([]chan []Event, 0)
-	for _, responder := range r.responders {
+	r.routeEvents(<-r.inbox)
+	for {
 		select {
-		case events := <-responder: // Wait for a event from the responder channel
-			for _, event := range events {
-				slog.Debug("Received event", "component", event.Component, "action", event.Action)
-				r.routeEvent(event) // Route the event to the appropriate queue
-			}
+		case events := <-r.inbox:
+			r.routeEvents(events)
 		default:
-			// No event available, continue to the next responder and keep it in the queue
-			remainingResponders = append(remainingResponders, responder)
+			slog.Debug("Received events", "waitingResponders", r.responders.Load())
+			return
 		}
 	}
-	r.responders = remainingResponders // Update the responders queue with the remaining responders
 }
 
-func (r *TriggerHandler) GetEvents() (bool, map[string]*Event) {
+func (r *TriggerHandler) routeEvents(events []Event) {
+	for _, event := range events {
+		slog.Debug("Received event", "component", event.Component, "action", event.Action)
+		r.routeEvent(event) // Route the event to the appropriate queue
+	}
+}
+
+// GetEvents takes every queued event. The events for each component are in the order they were received.
+func (r *TriggerHandler) GetEvents() (bool, map[string][]Event) {
 	r.eventLock.Lock()         // Lock the mutex to protect access to the queues
 	defer r.eventLock.Unlock() // Ensure the mutex is unlocked after accessing the queues
 	if r.hasEvents {
-		r.hasEvents = false                // Reset the flag indicating no events are left
-		events := r.events                 // take a copy of the events map
-		r.events = make(map[string]*Event) // Clear the events map after retrieving
-		return true, events                // Return true indicating events are available and the map of events
+		r.hasEvents = false                 // Reset the flag indicating no events are left
+		events := r.events                  // take a copy of the events map
+		r.events = make(map[string][]Event) // Clear the events map after retrieving
+		return true, events                 // Return true indicating events are available and the map of events
 	}
 	return false, nil // Return nil if no events are available
 }
@@ -0,0 +1,84 @@
+package ipc
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// Answer every trigger with a single auth event, like the backend does for getAuthData.
+func runEchoServer(tx chan Trigger) {
+	for trigger := range tx {
+		trigger.Responder <- []Event{{
+			Component: TOPIC_AUTH_CHANGED,
+			Action:    ACTION_AUTH_CHANGED,
+			Data:      AWSConfigData{Profile: "bench"},
+		}}
+		trigger.Close()
+	}
+}
+
+// The delivery path RunEventHandler used before the inbox: spin over every
+// responder with a non-blocking receive until one of them has a response.
+func pollForEvents(responders []chan []Event) (int, []chan []Event) {
+	polls := 0
+	for {
+		polls++
+		remaining := make([]chan []Event, 0)
+		received := false
+		for _, responder := range responders {
+			select {
+			case _, ok := <-responder:
+				received = received || ok
+			default:
+				remaining = append(remaining, responder)
+			}
+		}
+		responders = remaining
+		if received {
+			return polls, responders
+		}
+	}
+}
+
+func BenchmarkRoundTripPolling(b *testing.B) {
+	tx := make(chan Trigger, 100)
+	defer close(tx)
+	go runEchoServer(tx)
+
+	responders := make([]chan []Event, 0)
+	totalPolls := 0
+	for b.Loop() {
+		trigger := NewTrigger(context.Background(), Event{Component: COMPONENT_HEADER, Action: ACTION_GET_AUTH_DATA})
+		tx <- trigger
+		responders = append(responders, trigger.Responder)
+		var polls int
+		polls, responders = pollForEvents(responders)
+		totalPolls += polls
+	}
+	b.ReportMetric(float64(totalPolls)/float64(b.N), "wakeups/op")
+}
+
+func BenchmarkRoundTripInbox(b *testing.B) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tx := make(chan Trigger, 100)
+	defer close(tx)
+	go runEchoServer(tx)
+
+	push := make(chan []Event)
+	defer close(push)
+	handler := NewTriggerHandler(&tx, &push)
+	totalWakeups := 0
+	for b.Loop() {
+		handler.MakeTrigger(Event{Component: COMPONENT_HEADER, Action: ACTION_GET_AUTH_DATA})
+		for {
+			handler.RecieveEvents()
+			totalWakeups++
+			if hasEvents, _ := handler.GetEvents(); hasEvents {
+				break
+			}
+		}
+	}
+	b.ReportMetric(float64(totalWakeups)/float64(b.N), "wakeups/op")
+}
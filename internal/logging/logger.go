@@ -13,6 +13,8 @@ type LoggingConfig struct {
 	Json     bool   `json:"json"`      // Use JSON format for logs
 }
 
+var logFile *os.File // The file the logger writes to, nil when logging to stdout
+
 func getLogLevel(level string) slog.Level {
 	switch level {
 	case "DEBUG":
@@ -35,14 +37,15 @@ func ConfigureLogger(config LoggingConfig) {
 	}
 
 	var stream io.Writer
-	var err error
 	if config.LogFile == "" {
 		stream = os.Stdout
 	} else {
-		stream, err = os.OpenFile(config.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		file, err := os.OpenFile(config.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 		if err != nil {
 			log.Fatalf("Failed to open log file: %s", err)
 		}
+		logFile = file
+		stream = file
 	}
 
 	var handler slog.Handler
@@ -51,6 +54,18 @@ func ConfigureLogger(config LoggingConfig) {
 	} else {
 		handler = slog.NewTextHandler(stream, options)
 	}
-	logger := slog.New(handler)
+	logger := slog.New(contextHandler{handler})
 	slog.SetDefault(logger)
 }
+
+// Close flushes the log file to disk and closes it. Nothing may be logged afterwards.
+func Close() error {
+	if logFile == nil {
+		return nil
+	}
+	if err := logFile.Sync(); err != nil {
+		logFile.Close()
+		return err
+	}
+	return logFile.Close()
+}
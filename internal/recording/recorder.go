@@ -0,0 +1,104 @@
+package recording
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// Recorder sits between the tui and the backend and writes every trigger,
+// response and pushed event to a file. Each line is an ipc.Frame with the
+// time it was seen and every secret redacted. The file can be fed to a
+// Replayer to reproduce the session without a backend.
+type Recorder struct {
+	tx          *chan ipc.Trigger // Triggers from the tui
+	push        *chan []ipc.Event // Pushed events to the tui
+	backendTx   chan ipc.Trigger  // Triggers to the backend
+	backendPush chan []ipc.Event  // Pushed events from the backend
+	file        *os.File
+	codec       *ipc.Codec
+	idLock      sync.Mutex // Protects nextId
+	nextId      uint64
+}
+
+// NewRecorder creates the recording file. tx and push are the channels the
+// TriggerHandler uses, the backend must use the channels from Backend instead.
+func NewRecorder(path string, tx *chan ipc.Trigger, push *chan []ipc.Event) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		tx:          tx,
+		push:        push,
+		backendTx:   make(chan ipc.Trigger, 100),
+		backendPush: make(chan []ipc.Event, 100),
+		file:        file,
+		codec:       ipc.NewCodec(file),
+	}, nil
+}
+
+// Backend returns the channels the backend should read triggers from and push events on.
+func (r *Recorder) Backend() (*chan ipc.Trigger, *chan []ipc.Event) {
+	return &r.backendTx, &r.backendPush
+}
+
+// Run relays and records traffic until the quit trigger has been answered.
+func (r *Recorder) Run() {
+	slog.Info("Recording IPC traffic", "file", r.file.Name())
+	go r.relayPush()
+	for trigger := range *r.tx {
+		id := r.newId()
+		r.record(ipc.Frame{Kind: ipc.FRAME_TRIGGER, Id: id, Events: []ipc.Event{trigger.Event}})
+
+		relayed := ipc.NewTrigger(trigger.Context, trigger.Event)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			r.relayResponses(id, relayed, trigger)
+		}()
+		r.backendTx <- relayed
+
+		if trigger.Component == ipc.COMPONENT_QUIT {
+			<-done
+			r.file.Close()
+			slog.Info("Finished recording IPC traffic", "file", r.file.Name())
+			return
+		}
+	}
+}
+
+func (r *Recorder) newId() uint64 {
+	r.idLock.Lock()
+	defer r.idLock.Unlock()
+	r.nextId++
+	return r.nextId
+}
+
+// Record and pass on every batch the backend sends for a trigger, then close the original stream.
+func (r *Recorder) relayResponses(id uint64, relayed ipc.Trigger, original ipc.Trigger) {
+	for events := range relayed.Responder {
+		r.record(ipc.Frame{Kind: ipc.FRAME_EVENTS, Id: id, Events: events})
+		original.Responder <- events
+	}
+	r.record(ipc.Frame{Kind: ipc.FRAME_CLOSE, Id: id})
+	original.Close()
+}
+
+func (r *Recorder) relayPush() {
+	for events := range r.backendPush {
+		r.record(ipc.Frame{Kind: ipc.FRAME_PUSH, Events: events})
+		*r.push <- events
+	}
+}
+
+func (r *Recorder) record(frame ipc.Frame) {
+	frame.Time = time.Now()
+	frame.Events = ipc.Redact(frame.Events)
+	if err := r.codec.Write(frame); err != nil {
+		slog.Error("Failed to record frame", "kind", frame.Kind, "id", frame.Id, "error", err)
+	}
+}
@@ -0,0 +1,143 @@
+package recording
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+)
+
+// A trigger from the recording along with everything the backend sent for it.
+type recordedTrigger struct {
+	event     ipc.Event
+	responses [][]ipc.Event
+	position  int  // Index of the trigger frame in the recording
+	replayed  bool // Set once a live trigger has been matched to it
+}
+
+// Replayer stands in for the backend and answers triggers with the responses
+// from a recording. Live triggers are matched in order to the next recorded
+// trigger with the same Component/Action. Events that were pushed are replayed
+// once every trigger recorded before them has been replayed, so a session is
+// reproduced the same way every time regardless of timing.
+type Replayer struct {
+	tx       *chan ipc.Trigger
+	push     *chan []ipc.Event
+	triggers []*recordedTrigger
+	pushes   []recordedPush
+}
+
+type recordedPush struct {
+	events   []ipc.Event
+	position int // Index of the push frame in the recording
+}
+
+// NewReplayer loads a recording made by a Recorder.
+func NewReplayer(path string, tx *chan ipc.Trigger, push *chan []ipc.Event) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	replayer := &Replayer{
+		tx:       tx,
+		push:     push,
+		triggers: make([]*recordedTrigger, 0),
+		pushes:   make([]recordedPush, 0),
+	}
+	byId := make(map[uint64]*recordedTrigger)
+	codec := ipc.NewCodec(file)
+	for position := 0; ; position++ {
+		frame, err := codec.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch frame.Kind {
+		case ipc.FRAME_TRIGGER:
+			if frame.Events[0].Component == ipc.COMPONENT_QUIT {
+				continue // Answered locally, it must not hold back pushes recorded after it
+			}
+			recorded := &recordedTrigger{event: frame.Events[0], position: position}
+			byId[frame.Id] = recorded
+			replayer.triggers = append(replayer.triggers, recorded)
+		case ipc.FRAME_EVENTS:
+			if recorded, ok := byId[frame.Id]; ok {
+				recorded.responses = append(recorded.responses, frame.Events)
+			}
+		case ipc.FRAME_PUSH:
+			replayer.pushes = append(replayer.pushes, recordedPush{events: frame.Events, position: position})
+		}
+	}
+	slog.Info("Loaded recording", "file", path, "triggers", len(replayer.triggers), "pushes", len(replayer.pushes))
+	return replayer, nil
+}
+
+// Run answers triggers until a quit trigger is received.
+func (r *Replayer) Run() {
+	slog.Info("Replaying recorded IPC traffic")
+	r.replayPushesBefore(r.firstPending())
+	for trigger := range *r.tx {
+		if trigger.Component == ipc.COMPONENT_QUIT {
+			trigger.Responder <- []ipc.Event{{
+				Component: ipc.COMPONENT_QUIT,
+				Action:    ipc.ACTION_END,
+				Data:      nil,
+			}}
+			trigger.Close()
+			return
+		}
+		r.replay(trigger)
+	}
+}
+
+func (r *Replayer) replay(trigger ipc.Trigger) {
+	defer trigger.Close()
+	recorded := r.match(trigger.Event)
+	if recorded == nil {
+		slog.Warn("No recorded response for trigger", "component", trigger.Component, "action", trigger.Action)
+		message := "Replay: no recorded response for " + trigger.Component + "/" + trigger.Action
+		trigger.Responder <- append(ipc.FailedEvents(trigger, message), ipc.ErrorEvents(message)...)
+		return
+	}
+	slog.Debug("Replaying trigger", "component", trigger.Component, "action", trigger.Action, "position", recorded.position)
+	recorded.replayed = true
+	for _, events := range recorded.responses {
+		trigger.Responder <- events
+	}
+	r.replayPushesBefore(r.firstPending())
+}
+
+// The next recorded trigger with the same Component/Action that has not been replayed.
+func (r *Replayer) match(event ipc.Event) *recordedTrigger {
+	for _, recorded := range r.triggers {
+		if !recorded.replayed && recorded.event.Component == event.Component && recorded.event.Action == event.Action {
+			return recorded
+		}
+	}
+	return nil
+}
+
+// Position of the first recorded trigger that has not been replayed yet.
+func (r *Replayer) firstPending() int {
+	for _, recorded := range r.triggers {
+		if !recorded.replayed {
+			return recorded.position
+		}
+	}
+	return math.MaxInt // Everything has been replayed
+}
+
+// Replay every push recorded before the given position.
+func (r *Replayer) replayPushesBefore(position int) {
+	for len(r.pushes) > 0 && r.pushes[0].position < position {
+		*r.push <- r.pushes[0].events
+		r.pushes = r.pushes[1:]
+	}
+}
@@ -3,6 +3,7 @@ package tui
 import (
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/livinlefevreloca/canopy/internal/ipc"
@@ -54,6 +55,13 @@ type Renderable interface {
 	GetName() string // GetName returns the name of the component, used for identification
 }
 
+// A Renderable that implements Viewable is told when it is opened and closed
+// by the Tui, so it can subscribe to topics only while it is visible.
+type Viewable interface {
+	Opened()
+	Closed()
+}
+
 // The Tui struct represents the main TUI application.
 type Tui struct {
 	handle      *AppHandle
@@ -61,6 +69,7 @@ type Tui struct {
 	ui          *tview.Pages          // The main layout of the TUI application
 	currentPage string                // Track the current page in the TUI
 	pages       map[string]Renderable // Map of pages in the TUI
+	onQuit      func()                // Called when the user asks to quit
 }
 
 // Create a TUI instance and initialize it with the given trigger handler.
@@ -74,12 +83,18 @@ func NewTui(reqhandler *ipc.TriggerHandler) *Tui {
 	authModal := NewAuthModal(handle)
 	helpModal := NewHelpModal(handle)
 	ssoModal := NewSSOReauthenticationModal(handle)
+	mfaModal := NewMFAModal(handle)
+	credentialsModal := NewCredentialsServerModal(handle)
+	regionModal := NewRegionPickerModal(handle)
 	// Initialize the Tui instance with the AppHandle and modals
 	pages := make(map[string]Renderable)
 	pages[errorModal.GetName()] = errorModal
 	pages[authModal.GetName()] = authModal
 	pages[helpModal.GetName()] = helpModal
 	pages[ssoModal.GetName()] = ssoModal
+	pages[mfaModal.GetName()] = mfaModal
+	pages[credentialsModal.GetName()] = credentialsModal
+	pages[regionModal.GetName()] = regionModal
 
 	tui := &Tui{
 		handle:      handle,
@@ -88,6 +103,9 @@ func NewTui(reqhandler *ipc.TriggerHandler) *Tui {
 		currentPage: "",
 		pages:       pages,
 	}
+	tui.onQuit = func() {
+		tui.handle.SendTrigger(ipc.COMPONENT_QUIT, ipc.ACTION_END, nil)
+	}
 	tui.handle.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
 		case tcell.KeyCtrlA:
@@ -99,8 +117,15 @@ func NewTui(reqhandler *ipc.TriggerHandler) *Tui {
 		case tcell.KeyCtrlS:
 			tui.toggleComponent(ipc.COMPONENT_REFRESH_SSO)
 			tui.handle.SetRoot(tui.ui, true)
+		case tcell.KeyCtrlE:
+			tui.toggleComponent(credentialsModal.GetName())
+			tui.handle.SetRoot(tui.ui, true)
+		case tcell.KeyCtrlR:
+			tui.toggleComponent(regionModal.GetName())
+			tui.handle.SetRoot(tui.ui, true)
 		case tcell.KeyCtrlC:
-			tui.handle.SendTrigger(ipc.COMPONENT_QUIT, ipc.ACTION_END, nil)
+			tui.onQuit()
+			return nil // Handled here, tview would stop the application itself
 		default:
 		}
 		return event
@@ -118,7 +143,7 @@ func NewTui(reqhandler *ipc.TriggerHandler) *Tui {
 
 	mainLayout := tview.NewFlex().
 		SetDirection(tview.FlexRow).
-		AddItem(header.ui, 7, 1, false).
+		AddItem(header.ui, 9, 1, false).
 		AddItem(mainText, 0, 1, false)
 
 	mainPages := tview.NewPages()
@@ -127,6 +152,9 @@ func NewTui(reqhandler *ipc.TriggerHandler) *Tui {
 	mainPages.AddPage(helpModal.GetName(), helpModal.ui, true, false)
 	mainPages.AddPage(errorModal.GetName(), errorModal.ui, true, false)
 	mainPages.AddPage(ssoModal.GetName(), ssoModal.ui, true, false)
+	mainPages.AddPage(mfaModal.GetName(), mfaModal.ui, true, false)
+	mainPages.AddPage(credentialsModal.GetName(), credentialsModal.ui, true, false)
+	mainPages.AddPage(regionModal.GetName(), regionModal.ui, true, false)
 
 	tui.handle.SetSubscription(tui.GetName(), tui)
 
@@ -147,8 +175,14 @@ func (t *Tui) Render(response *ipc.Event) tview.Primitive {
 		t.ShowComponent(ipc.COMPONENT_REFRESH_SSO)
 	case ipc.ACTION_CLOSE_REAUTHENTICATE_SSO_MODAL:
 		t.HideComponent(ipc.COMPONENT_REFRESH_SSO)
+	case ipc.ACTION_SHOW_MFA_MODAL:
+		t.ShowComponent(ipc.COMPONENT_MFA_MODAL)
+	case ipc.ACTION_CLOSE_MFA_MODAL:
+		t.HideComponent(ipc.COMPONENT_MFA_MODAL)
 	case ipc.ACTION_CLOSE_AUTH_MODAL:
 		t.HideComponent(ipc.COMPONENT_AUTH_MODAL)
+	case ipc.ACTION_CLOSE_REGION_PICKER:
+		t.HideComponent(ipc.COMPONENT_REGION_PICKER)
 	}
 
 	return t.ui
@@ -164,6 +198,17 @@ func (t *Tui) Run() error {
 	return nil
 }
 
+// SetOnQuit replaces what happens when the user asks to quit. By default a
+// quit trigger is sent to the backend.
+func (t *Tui) SetOnQuit(onQuit func()) {
+	t.onQuit = onQuit
+}
+
+// Stop stops the application and restores the terminal. Run returns afterwards.
+func (t *Tui) Stop() {
+	t.handle.Stop()
+}
+
 func (t *Tui) toggleComponent(componentName string) {
 	component, _ := t.pages[componentName]
 	otherComponents := make([]string, len(t.pages)-1)
@@ -178,12 +223,27 @@ func (t *Tui) toggleComponent(componentName string) {
 	if componentName != t.currentPage {
 		t.currentPage = componentName
 		t.ui.ShowPage(componentName)
+		t.opened(componentName)
 		for _, comp := range otherComponents {
 			t.ui.HidePage(comp)
+			t.closed(comp)
 		}
 	} else {
 		t.currentPage = ""
 		t.ui.HidePage(componentName)
+		t.closed(componentName)
+	}
+}
+
+func (t *Tui) opened(componentName string) {
+	if viewable, ok := t.pages[componentName].(Viewable); ok {
+		viewable.Opened()
+	}
+}
+
+func (t *Tui) closed(componentName string) {
+	if viewable, ok := t.pages[componentName].(Viewable); ok {
+		viewable.Closed()
 	}
 }
 
@@ -195,6 +255,7 @@ func (t *Tui) ShowComponent(componentName string) {
 	if t.currentPage != componentName {
 		t.currentPage = componentName
 		t.ui.ShowPage(componentName)
+		t.opened(componentName)
 	}
 	return
 }
@@ -208,6 +269,7 @@ func (t *Tui) HideComponent(componentName string) {
 	if t.currentPage == componentName {
 		t.currentPage = "main"
 		t.ui.HidePage(componentName)
+		t.closed(componentName)
 	}
 }
 
@@ -215,10 +277,15 @@ func (t *Tui) GetName() string {
 	return t.name
 }
 
+// How often the countdown to the expiry of the credentials is redrawn
+const HEADER_COUNTDOWN_INTERVAL = time.Second
+
 type Header struct {
-	handle *AppHandle
-	name   string
-	ui     tview.Primitive
+	handle   *AppHandle
+	name     string
+	ui       tview.Primitive
+	expiring bool          // The backend warned that the credentials expire soon and will not be refreshed
+	ticking  chan struct{} // Closed to stop the countdown, nil while it is not running
 	ipc.AWSConfigData
 }
 
@@ -230,13 +297,7 @@ func NewHeader(configData ipc.AWSConfigData, handle *AppHandle) *Header {
 		AWSConfigData: configData,
 	}
 
-	text := "[yellow]AWS Profile: [white]" + header.Profile + "\n" +
-		"[yellow]AWS SSO Role Name: [white]" + header.SSORoleName + "\n" +
-		"[yellow]AWS Account Id: [white]" + header.AccountId + "\n" +
-		"[yellow]AWS Assumed Role: [white]" + header.AssumeRoleARN + "\n" +
-		"[yellow]AWS Access Key ID: [white]" + header.AccessKeyID + "\n" +
-		"[yellow]AWS Credentials Source: [white]" + header.CredentialsSource + "\n" +
-		"[yellow]AWS Region: [white]" + header.Region
+	text := headerText(header.AWSConfigData, header.expiring)
 
 	ui := tview.NewTextView().
 		SetDynamicColors(true).
@@ -246,12 +307,43 @@ func NewHeader(configData ipc.AWSConfigData, handle *AppHandle) *Header {
 	header.ui = ui
 
 	header.handle.SetSubscription(header.GetName(), &header)
+	header.handle.Subscribe(ipc.TOPIC_AUTH_CHANGED, &header)
 	// Trigger the initial AWS config data
 	header.TriggerAuth()
+	header.updateCountdown()
 
 	return &header
 }
 
+// Run the countdown only while the credentials expire, so nothing is redrawn
+// while idle with credentials that do not.
+func (h *Header) updateCountdown() {
+	switch {
+	case !h.Expires.IsZero() && h.ticking == nil:
+		h.ticking = make(chan struct{})
+		go h.countdown(h.ticking)
+	case h.Expires.IsZero() && h.ticking != nil:
+		close(h.ticking)
+		h.ticking = nil
+	}
+}
+
+// Redraw the header every interval so the time until the credentials expire stays current.
+func (h *Header) countdown(stop <-chan struct{}) {
+	ticker := time.NewTicker(HEADER_COUNTDOWN_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			h.handle.QueueUpdateDraw(func() {
+				h.ui.(*tview.TextView).SetText(headerText(h.AWSConfigData, h.expiring))
+			})
+		}
+	}
+}
+
 func (h *Header) TriggerAuth() {
 	h.handle.SendTrigger(h.name, ipc.ACTION_GET_AUTH_DATA, nil)
 }
@@ -260,26 +352,68 @@ func (h *Header) Render(event *ipc.Event) tview.Primitive {
 	// take the last response and update the header with the latest config data
 	slog.Debug("Header Render: Received event", "event", event)
 
-	configData, ok := event.Data.(ipc.AWSConfigData)
-	if !ok {
-		panic(fmt.Sprintf("Header Render: Expected AWSConfigData, got %x", event.Data))
+	if event.Action == ipc.ACTION_CREDENTIALS_EXPIRING {
+		if expiring, err := ipc.Handle[ipc.CredentialsExpiringData](event); err == nil && expiring.Expires.Equal(h.Expires) {
+			h.expiring = true
+			h.ui.(*tview.TextView).SetText(headerText(h.AWSConfigData, h.expiring))
+		}
+		return h.ui
+	}
+
+	if event.Action != ipc.ACTION_AUTH_CHANGED {
+		// Cancelled, timed out or failed refresh. Keep showing the last known config, the next refresh will update it
+		slog.Warn("Header Render: Auth data request did not finish", "reason", event.Action)
+		return h.ui
+	}
+
+	configData, err := ipc.Handle[ipc.AWSConfigData](event)
+	if err != nil {
+		slog.Error("Header Render: Unexpected payload", "error", err)
+		h.handle.ShowError(err.Error())
+		return h.ui
+	}
+	if !configData.Expires.Equal(h.Expires) {
+		h.expiring = false // New credentials
 	}
 	h.AWSConfigData = configData
+	h.updateCountdown()
 
 	// Return the UI component for this header
-	text := "[yellow]AWS Profile: [white]" + h.Profile + "\n" +
-		"[yellow]AWS SSO Role Name: [white]" + h.SSORoleName + "\n" +
-		"[yellow]AWS Account Id: [white]" + h.AccountId + "\n" +
-		"[yellow]AWS Assumed Role: [white]" + h.AssumeRoleARN + "\n" +
-		"[yellow]AWS Access Key ID: [white]" + h.AccessKeyID + "\n" +
-		"[yellow]AWS Credentials Source: [white]" + h.CredentialsSource + "\n" +
-		"[yellow]AWS Region: [white]" + h.Region
+	text := headerText(h.AWSConfigData, h.expiring)
 
 	h.ui.(*tview.TextView).SetText(text)
 
 	return h.ui
 }
 
+func headerText(configData ipc.AWSConfigData, expiring bool) string {
+	return "[yellow]AWS Profile: [white]" + configData.Profile + "\n" +
+		"[yellow]AWS Auth Type: [white]" + configData.AuthType + "\n" +
+		"[yellow]AWS SSO Role Name: [white]" + configData.SSORoleName + "\n" +
+		"[yellow]AWS Account Id: [white]" + configData.AccountId + "\n" +
+		"[yellow]AWS Assumed Role: [white]" + configData.AssumeRoleARN + "\n" +
+		"[yellow]AWS Access Key ID: [white]" + configData.AccessKeyID + "\n" +
+		"[yellow]AWS Credentials Source: [white]" + configData.CredentialsSource + "\n" +
+		"[yellow]AWS Region: [white]" + configData.Region + "\n" +
+		"[yellow]AWS Credentials Expire: " + expiryText(configData.Expires, expiring)
+}
+
+// The time left until the credentials expire, in red once they are about to.
+func expiryText(expires time.Time, expiring bool) string {
+	if expires.IsZero() {
+		return "[white]never"
+	}
+	remaining := time.Until(expires).Truncate(time.Second)
+	switch {
+	case remaining <= 0:
+		return "[red]expired"
+	case expiring:
+		return "[red]in " + remaining.String() + ", reauthenticate to keep working"
+	default:
+		return "[white]in " + remaining.String()
+	}
+}
+
 func (h *Header) GetName() string {
 	return h.name
 }
@@ -10,38 +10,61 @@ import (
 type AppHandle struct {
 	*tview.Application
 	triggerHandler *ipc.TriggerHandler
-	subscriptions  map[string]Renderable
+	subscriptions  *ipc.Subscriptions[Renderable]
 }
 
 func NewAppHandle(triggerHandler *ipc.TriggerHandler, app *tview.Application) *AppHandle {
 	return &AppHandle{
 		Application:    app,
 		triggerHandler: triggerHandler,
-		subscriptions:  make(map[string]Renderable),
+		subscriptions:  ipc.NewSubscriptions[Renderable](),
 	}
 }
 
+// SetSubscription registers a component to receive the events addressed to it.
 func (a *AppHandle) SetSubscription(component string, sub Renderable) {
-	a.subscriptions[component] = sub
+	a.subscriptions.Subscribe(component, sub)
 }
 
-func (a *AppHandle) SendTrigger(component string, action string, data interface{}) {
-	event := ipc.Event{
-		Component: component,
-		Action:    action,
-		Data:      data,
+// Subscribe adds a Renderable to the subscribers of a topic. Use the returned id to Unsubscribe.
+func (a *AppHandle) Subscribe(topic string, sub Renderable) ipc.SubscriptionID {
+	return a.subscriptions.Subscribe(topic, sub)
+}
+
+func (a *AppHandle) Unsubscribe(id ipc.SubscriptionID) {
+	a.subscriptions.Unsubscribe(id)
+}
+
+// SendTrigger sends a trigger to the backend. The returned handle can be used to
+// cancel it, it is nil if the trigger could not be sent.
+func (a *AppHandle) SendTrigger(component string, action string, data interface{}) *ipc.TriggerHandle {
+	handle, err := ipc.Send(a.triggerHandler, component, action, data)
+	if err != nil {
+		slog.Error("Failed to send trigger", "component", component, "action", action, "error", err)
+		// Let the component leave any progress it started showing for the request
+		for _, event := range ipc.FailedEvents(ipc.Trigger{Event: ipc.Event{Component: component, Action: action}}, err.Error()) {
+			a.triggerHandler.PassEvent(event)
+		}
+		a.ShowError(err.Error())
 	}
-	a.triggerHandler.MakeTrigger(event)
+	return handle
 }
 
 func (a *AppHandle) PassEvent(response ipc.Event) {
 	a.triggerHandler.PassEvent(response)
 }
 
+// ShowError opens the error modal with the given message.
+func (a *AppHandle) ShowError(message string) {
+	for _, event := range ipc.ErrorEvents(message) {
+		a.triggerHandler.PassEvent(event)
+	}
+}
+
 func (a *AppHandle) RunEventHandler() error {
 	slog.Info("Starting event handler for TUI application")
 	for {
-		a.triggerHandler.RecieveEvents()
+		a.triggerHandler.RecieveEvents()                                  // Blocks until there is something to render
 		if hasEvents, events := a.triggerHandler.GetEvents(); hasEvents { // Only update the UI if there are new events
 			slog.Debug("Received new events, processing them")
 			_, ok := events[ipc.COMPONENT_QUIT]
@@ -51,11 +74,12 @@ func (a *AppHandle) RunEventHandler() error {
 			}
 			// If we have responses for other components, we update the UI
 			a.QueueUpdateDraw(func() {
-				for component, sub := range a.subscriptions {
-					event, ok := events[component] // Get the event for the component
-					if ok {
-						slog.Debug("Processing event for component", slog.String("component", component))
-						sub.Render(event)
+				for topic, queue := range events {
+					for _, sub := range a.subscriptions.Subscribers(topic) { // Every subscriber gets every event in order
+						for i := range queue {
+							slog.Debug("Processing event for component", slog.String("topic", topic), slog.String("component", sub.GetName()), slog.String("action", queue[i].Action))
+							sub.Render(&queue[i])
+						}
 					}
 				}
 			})
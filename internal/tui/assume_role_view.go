@@ -0,0 +1,171 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+	"github.com/rivo/tview"
+)
+
+type AssumeRoleView struct {
+	ui          *tview.Pages
+	name        string
+	handle      *AppHandle
+	setMessage  func(string)            // Function to set the message above the form
+	setProgress func(string)            // Function to set the message on the assuming page
+	setIdentity func(ipc.AWSConfigData) // Function to show the current identity and the role chain
+	assuming    *ipc.TriggerHandle      // The in flight assume role or step back, if any
+}
+
+func NewAssumeRoleView(handle *AppHandle) *AssumeRoleView {
+	pages := tview.NewPages()
+	view := AssumeRoleView{
+		ui:     nil,
+		name:   ipc.COMPONENT_ASSUME_ROLE,
+		handle: handle,
+	}
+
+	// inputs page
+	form := tview.NewForm().
+		SetFieldTextColor(tcell.ColorBlack).
+		SetFieldBackgroundColor(tcell.ColorWhite).
+		AddInputField("Role ARN: ", "", 60, nil, nil).
+		AddInputField("Session Name: ", "", 40, nil, nil).
+		AddInputField("Duration (seconds): ", "3600", 10, tview.InputFieldInteger, nil).
+		AddPasswordField("External ID (optional): ", "", 40, '*', nil)
+	form.AddButton("Assume Role", func() {
+		roleARN := strings.TrimSpace(form.GetFormItem(0).(*tview.InputField).GetText())
+		sessionName := strings.TrimSpace(form.GetFormItem(1).(*tview.InputField).GetText())
+		duration := form.GetFormItem(2).(*tview.InputField).GetText()
+		externalID := form.GetFormItem(3).(*tview.InputField).GetText()
+		if roleARN == "" {
+			view.setMessage("A role ARN is required")
+			return
+		}
+		if sessionName == "" {
+			sessionName = fmt.Sprintf("canopy-%d", time.Now().Unix())
+		}
+		seconds, err := strconv.ParseInt(duration, 10, 32)
+		if duration != "" && (err != nil || seconds < 0) {
+			view.setMessage("The duration must be a number of seconds")
+			return
+		}
+		view.setProgress("Assuming Role...")
+		view.ui.ShowPage("assuming")
+		view.assuming = view.handle.SendTrigger(view.name, ipc.ACTION_ASSUME_ROLE, ipc.AssumeRoleData{
+			RoleARN:         roleARN,
+			SessionName:     sessionName,
+			DurationSeconds: int32(seconds),
+			ExternalID:      externalID,
+		})
+	})
+	form.AddButton("Step Back", func() {
+		view.setProgress("Stepping back to the previous identity...")
+		view.ui.ShowPage("assuming")
+		view.assuming = view.handle.SendTrigger(view.name, ipc.ACTION_STEP_BACK_ROLE, nil)
+	})
+
+	message := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetText("Assume a Role From the Current Identity")
+	view.setMessage = func(text string) {
+		message.SetText(text)
+	}
+
+	identity := tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(tview.AlignLeft)
+	view.setIdentity = func(configData ipc.AWSConfigData) {
+		current := configData.AssumeRoleARN
+		if current == "" {
+			current = "profile " + configData.Profile
+		}
+		text := "Current Identity: [yellow]" + current + "[white]"
+		for i := len(configData.RoleChain) - 1; i >= 0; i-- {
+			text += "\n  assumed from: " + configData.RoleChain[i]
+		}
+		identity.SetText(text)
+	}
+
+	flex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(message, 1, 1, false).
+		AddItem(tview.NewBox(), 1, 1, false). // Spacer
+		AddItem(identity, 4, 1, false).
+		AddItem(form, 0, 1, true)
+
+	flex.SetBorder(true)
+	flex.SetBorderPadding(2, 2, 2, 2)
+	flex.SetTitle(authTabTitle(ipc.COMPONENT_ASSUME_ROLE))
+
+	// assuming page
+	assuming := tview.NewTextView().
+		SetText("Assuming Role...\n\nPress Esc to cancel").
+		SetTextAlign(tview.AlignCenter)
+	view.setProgress = func(message string) {
+		assuming.SetText(message + "\n\nPress Esc to cancel")
+	}
+	assuming.SetBorder(true)
+	assuming.SetBorderPadding(2, 2, 2, 2)
+	assuming.SetTitle(authTabTitle(ipc.COMPONENT_ASSUME_ROLE))
+
+	pages.AddPage("inputs", flex, true, true)
+	pages.AddPage("assuming", assuming, true, false)
+
+	pages.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			// Abort the in flight request, the backend answers with a cancelled event.
+			// Go back to the form either way, the request may have failed with an error.
+			view.assuming.Cancel()
+			view.ui.HidePage("assuming")
+			return nil
+		}
+		return event
+	})
+
+	view.handle.SetSubscription(view.name, &view)
+	view.ui = pages
+
+	return &view
+}
+
+func (view *AssumeRoleView) Render(event *ipc.Event) tview.Primitive {
+	switch event.Action {
+	case ipc.ACTION_PROGRESS:
+		if progress, err := ipc.Handle[ipc.ProgressData](event); err == nil {
+			view.setProgress(progress.Message)
+		}
+		return view.ui
+	case ipc.ACTION_AUTH_CHANGED:
+		if configData, err := ipc.Handle[ipc.AWSConfigData](event); err == nil {
+			view.setIdentity(configData)
+		}
+		return view.ui
+	}
+
+	view.assuming = nil
+	view.ui.HidePage("assuming")
+	switch event.Action {
+	case ipc.ACTION_ASSUME_ROLE:
+		view.setMessage("Role assumed, press Step Back to return to the previous identity")
+	case ipc.ACTION_STEP_BACK_ROLE:
+		view.setMessage("Returned to the previous identity")
+	case ipc.ACTION_CANCELLED:
+		view.setMessage("Request was cancelled")
+	case ipc.ACTION_TIMED_OUT:
+		view.setMessage("Request timed out")
+	case ipc.ACTION_FAILED:
+		view.setMessage("Request failed")
+	}
+
+	return view.ui
+}
+
+func (view *AssumeRoleView) GetName() string {
+	return view.name
+}
@@ -1,6 +1,8 @@
 package tui
 
 import (
+	"strings"
+
 	"github.com/gdamore/tcell/v2"
 	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
 	"github.com/livinlefevreloca/canopy/internal/ipc"
@@ -13,6 +15,32 @@ type AuthModal struct {
 	handle      *AppHandle
 	currentPage string // Track the current page in the modal
 	pages       map[string]Renderable
+	authSubs    []ipc.SubscriptionID // Subscriptions to the auth topic while the modal is open
+}
+
+// The tabs of the auth modal in the order TAB cycles through them
+var authTabs = []struct {
+	component string
+	title     string
+}{
+	{ipc.COMPONENT_CHANGE_PROFILE, "Change Profile"},
+	{ipc.COMPONENT_SET_ACCESS_KEYS, "Set Access Keys"},
+	{ipc.COMPONENT_ASSUME_ROLE, "Assume Role"},
+	{ipc.COMPONENT_SSO_BROWSER, "SSO Accounts"},
+	{ipc.COMPONENT_PROFILE_EDITOR, "Edit Profiles"},
+}
+
+// The title of a page of the auth modal, listing every tab with the active one highlighted.
+func authTabTitle(active string) string {
+	titles := make([]string, 0, len(authTabs))
+	for _, tab := range authTabs {
+		if tab.component == active {
+			titles = append(titles, "[yellow]"+tab.title+"[white]")
+		} else {
+			titles = append(titles, tab.title)
+		}
+	}
+	return " " + strings.Join(titles, " ═════ ") + " "
 }
 
 func NewAuthModal(handle *AppHandle) *AuthModal {
@@ -25,8 +53,20 @@ func NewAuthModal(handle *AppHandle) *AuthModal {
 	newAccessKey := NewSetAccessKeysView(handle)
 	pagesMap[newAccessKey.GetName()] = newAccessKey
 
+	assumeRole := NewAssumeRoleView(handle)
+	pagesMap[assumeRole.GetName()] = assumeRole
+
+	ssoBrowser := NewSSOBrowserView(handle)
+	pagesMap[ssoBrowser.GetName()] = ssoBrowser
+
+	profileEditor := NewProfileEditorView(handle)
+	pagesMap[profileEditor.GetName()] = profileEditor
+
 	pages.AddPage(changeProfile.GetName(), changeProfile.ui, true, true)
 	pages.AddPage(newAccessKey.GetName(), newAccessKey.ui, true, false)
+	pages.AddPage(assumeRole.GetName(), assumeRole.ui, true, false)
+	pages.AddPage(ssoBrowser.GetName(), ssoBrowser.ui, true, false)
+	pages.AddPage(profileEditor.GetName(), profileEditor.ui, true, false)
 
 	am := &AuthModal{
 		ui:          makeModal(pages), // Adjust width and height as needed
@@ -53,6 +93,25 @@ func (am *AuthModal) Render(events *ipc.Event) tview.Primitive {
 	return am.ui
 }
 
+// Opened subscribes the pages that show the current identity to the auth topic
+// and asks for the current identity so they are up to date.
+func (am *AuthModal) Opened() {
+	if len(am.authSubs) == 0 {
+		for _, page := range []string{ipc.COMPONENT_CHANGE_PROFILE, ipc.COMPONENT_ASSUME_ROLE} {
+			am.authSubs = append(am.authSubs, am.handle.Subscribe(ipc.TOPIC_AUTH_CHANGED, am.pages[page]))
+		}
+	}
+	am.handle.SendTrigger(ipc.COMPONENT_HEADER, ipc.ACTION_GET_AUTH_DATA, nil)
+}
+
+// Closed stops listening to the auth topic until the modal is opened again.
+func (am *AuthModal) Closed() {
+	for _, id := range am.authSubs {
+		am.handle.Unsubscribe(id)
+	}
+	am.authSubs = nil
+}
+
 func (am *AuthModal) SetFocus(p tview.Primitive) {
 	// Set focus to the given primitive
 	am.handle.SetFocus(p)
@@ -63,14 +122,12 @@ func (am *AuthModal) GetName() string {
 }
 
 func (am *AuthModal) cycleTab(pages *tview.Pages) {
-	var newPage, oldPage string
-	switch am.currentPage {
-	case ipc.COMPONENT_CHANGE_PROFILE:
-		oldPage = ipc.COMPONENT_CHANGE_PROFILE
-		newPage = ipc.COMPONENT_SET_ACCESS_KEYS
-	case ipc.COMPONENT_SET_ACCESS_KEYS:
-		oldPage = ipc.COMPONENT_SET_ACCESS_KEYS
-		newPage = ipc.COMPONENT_CHANGE_PROFILE
+	oldPage := am.currentPage
+	newPage := authTabs[0].component
+	for i, tab := range authTabs {
+		if tab.component == oldPage {
+			newPage = authTabs[(i+1)%len(authTabs)].component
+		}
 	}
 	am.setPage(newPage)
 	pages.ShowPage(newPage)
@@ -89,6 +146,12 @@ type ChangeProfileView struct {
 	name            string
 	handle          *AppHandle
 	selectedProfile string
+	profiles        *tview.List        // Every profile from the AWS config and credentials files
+	button          *tview.Button      // Switches to the selected profile
+	setMessage      func(string)       // Function to set the message above the profile list
+	setProgress     func(string)       // Function to set the message on the switching page
+	setCurrent      func(string)       // Function to set the currently active profile
+	switching       *ipc.TriggerHandle // The in flight profile switch, if any
 }
 
 func NewChangeProfileView(handle *AppHandle) *ChangeProfileView {
@@ -103,46 +166,58 @@ func NewChangeProfileView(handle *AppHandle) *ChangeProfileView {
 	// inputs page
 	button := tview.NewButton("Switch Profile").SetSelectedFunc(func() {
 		if view.selectedProfile != "" {
-			view.ui.ShowPage("changing")
-			view.handle.SendTrigger(view.name, ipc.ACTION_CHANGE_PROFILE, ipc.ChangeProfileData{
+			view.setProgress("Switching Profile...")
+			view.ui.ShowPage("switching")
+			view.switching = view.handle.SendTrigger(view.name, ipc.ACTION_CHANGE_PROFILE, ipc.ChangeProfileData{
 				Profile: view.selectedProfile,
 			})
 			view.selectedProfile = "" // Reset selected profile after switching
 		}
 	})
 
+	view.button = button
 	profileList := tview.NewList()
-	for _, profile := range awsAuth.GetAvailableProfiles() {
-		profileList.AddItem(profile, "", 0, func() {
-			view.selectedProfile = profile
-			view.handle.SetFocus(button)
-		})
-	}
 	profileList.ShowSecondaryText(false)
+	view.profiles = profileList
+	view.loadProfiles()
+
+	message := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetText("Select a Profile to Switch To")
+	view.setMessage = func(text string) {
+		message.SetText(text)
+	}
+
+	current := tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(tview.AlignCenter)
+	view.setCurrent = func(profile string) {
+		current.SetText("Current Profile: [yellow]" + profile)
+	}
 
 	flex := tview.NewFlex().
 		SetDirection(tview.FlexRow).
-		AddItem(
-			tview.NewTextView().
-				SetTextAlign(tview.AlignCenter).
-				SetText("Select a Profile to Switch To"),
-			2, 1, false).
+		AddItem(message, 1, 1, false).
+		AddItem(current, 1, 1, false).
 		AddItem(profileList, 0, 1, true).
 		AddItem(tview.NewBox(), 1, 1, false). // Spacer
 		AddItem(button, 3, 1, false)
 
 	flex.SetBorder(true)
 	flex.SetBorderPadding(2, 2, 2, 2)
-	flex.SetTitle(" [yellow]Change Profile[white] ═════ Set Access Keys ")
+	flex.SetTitle(authTabTitle(ipc.COMPONENT_CHANGE_PROFILE))
 
 	// switching page
 	switching := tview.NewTextView().
-		SetText("Switching Profile...").
+		SetText("Switching Profile...\n\nPress Esc to cancel").
 		SetTextAlign(tview.AlignCenter)
+	view.setProgress = func(message string) {
+		switching.SetText(message + "\n\nPress Esc to cancel")
+	}
 
 	switching.SetBorder(true)
 	switching.SetBorderPadding(2, 2, 2, 2)
-	switching.SetTitle(" [yellow]Change Profile[white] ═════ Set Access Keys ")
+	switching.SetTitle(authTabTitle(ipc.COMPONENT_CHANGE_PROFILE))
 
 	// success page
 	success := tview.NewFlex().
@@ -163,7 +238,7 @@ func NewChangeProfileView(handle *AppHandle) *ChangeProfileView {
 
 	success.SetBorder(true)
 	success.SetBorderPadding(2, 2, 2, 2)
-	success.SetTitle(" [yellow]Change Profile[white] ═════ Set Access Keys ")
+	success.SetTitle(authTabTitle(ipc.COMPONENT_CHANGE_PROFILE))
 
 	pages.AddPage("input", flex, true, true)
 	pages.AddPage("switching", switching, true, false)
@@ -176,19 +251,62 @@ func NewChangeProfileView(handle *AppHandle) *ChangeProfileView {
 				// If the button has focus, move focus back to the profile list
 				view.handle.SetFocus(profileList)
 			}
+		case tcell.KeyEscape:
+			// Abort the in flight switch, the backend answers with a cancelled event
+			view.switching.Cancel()
 		}
 		return event
 	})
 
 	view.handle.SetSubscription(view.name, &view)
+	view.handle.Subscribe(ipc.TOPIC_PROFILES_CHANGED, &view)
 	view.ui = pages
 
 	return &view
 }
 
+// Fill the profile list from the AWS config and credentials files.
+func (view *ChangeProfileView) loadProfiles() {
+	view.profiles.Clear()
+	view.selectedProfile = ""
+	for _, profile := range awsAuth.GetAvailableProfiles() {
+		view.profiles.AddItem(profile.Name+" ("+string(profile.AuthType)+")", "", 0, func() {
+			view.selectedProfile = profile.Name
+			view.handle.SetFocus(view.button)
+		})
+	}
+}
+
 func (view *ChangeProfileView) Render(event *ipc.Event) tview.Primitive {
+	switch event.Action {
+	case ipc.ACTION_PROFILES_CHANGED:
+		view.loadProfiles()
+		return view.ui
+	case ipc.ACTION_PROGRESS:
+		if progress, err := ipc.Handle[ipc.ProgressData](event); err == nil {
+			view.setProgress(progress.Message)
+		}
+		return view.ui
+	case ipc.ACTION_AUTH_CHANGED:
+		if configData, err := ipc.Handle[ipc.AWSConfigData](event); err == nil {
+			view.setCurrent(configData.Profile)
+		}
+		return view.ui
+	}
+
+	view.switching = nil
 	view.ui.HidePage("switching")
-	view.ui.ShowPage("success")
+	switch event.Action {
+	case ipc.ACTION_CHANGE_PROFILE:
+		view.setMessage("Select a Profile to Switch To")
+		view.ui.ShowPage("success")
+	case ipc.ACTION_CANCELLED:
+		view.setMessage("Profile switch was cancelled")
+	case ipc.ACTION_TIMED_OUT:
+		view.setMessage("Profile switch timed out")
+	case ipc.ACTION_FAILED:
+		view.setMessage("Profile switch failed, select a profile to try again")
+	}
 
 	return view.ui
 }
@@ -198,10 +316,13 @@ func (view *ChangeProfileView) GetName() string {
 }
 
 type SetAccessKeysView struct {
-	ui      *tview.Pages
-	name    string
-	handle  *AppHandle
-	setting bool
+	ui          *tview.Pages
+	name        string
+	handle      *AppHandle
+	setMessage  func(string)       // Function to set the message above the form
+	setProgress func(string)       // Function to set the message on the setting page
+	clearInputs func()             // Function to empty the form, so the keys do not stay in it
+	setting     *ipc.TriggerHandle // The in flight request, if any
 }
 
 func NewSetAccessKeysView(handle *AppHandle) *SetAccessKeysView {
@@ -209,62 +330,70 @@ func NewSetAccessKeysView(handle *AppHandle) *SetAccessKeysView {
 		ui:      nil,
 		name:    ipc.COMPONENT_SET_ACCESS_KEYS,
 		handle:  handle,
-		setting: false,
+		setting: nil,
 	}
 	pages := tview.NewPages()
 
 	// Inputs page
-	accessKeyIDInput := tview.NewInputField().
-		SetLabel("Access Key ID: ").
-		SetFieldWidth(30).
+	form := tview.NewForm().
 		SetFieldTextColor(tcell.ColorBlack).
-		SetFieldBackgroundColor(tcell.ColorWhite) // Set initial background color
-
-	secretAccessKeyInput := tview.NewInputField().
-		SetLabel("Secret Access Key: ").
-		SetFieldWidth(30).
-		SetMaskCharacter('*').
-		SetFieldTextColor(tcell.ColorBlack)
-
-	button := tview.NewButton("Set Access Keys").SetSelectedFunc(func() {
-		accessKeyID := accessKeyIDInput.GetText()
-		secretAccessKey := secretAccessKeyInput.GetText()
-
-		if accessKeyID != "" && secretAccessKey != "" {
-			view.setting = true
-			view.ui.ShowPage("setting")
-			view.handle.SendTrigger(view.name, "reauthWithNewAccessKeys", &ipc.AWSAccessKeysData{
-				AccessKeyID:     accessKeyID,
-				SecretAccessKey: secretAccessKey,
-			})
+		SetFieldBackgroundColor(tcell.ColorWhite).
+		AddInputField("Access Key ID: ", "", 30, nil, nil).
+		AddPasswordField("Secret Access Key: ", "", 45, '*', nil).
+		AddPasswordField("Session Token (optional): ", "", 45, '*', nil).
+		AddInputField("Save as Profile (optional): ", "", 30, nil, nil)
+	form.AddButton("Set Access Keys", func() {
+		accessKeyID := strings.TrimSpace(form.GetFormItem(0).(*tview.InputField).GetText())
+		secretAccessKey := strings.TrimSpace(form.GetFormItem(1).(*tview.InputField).GetText())
+		sessionToken := strings.TrimSpace(form.GetFormItem(2).(*tview.InputField).GetText())
+		profile := strings.TrimSpace(form.GetFormItem(3).(*tview.InputField).GetText())
+		if accessKeyID == "" || secretAccessKey == "" {
+			view.setMessage("[red]An access key ID and secret access key are required")
+			return
 		}
+		view.setProgress("Validating access keys...")
+		view.ui.ShowPage("setting")
+		view.setting = view.handle.SendTrigger(view.name, ipc.ACTION_SET_ACCESS_KEYS, ipc.AWSAccessKeysData{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			SessionToken:    sessionToken,
+			SaveAsProfile:   profile,
+		})
 	})
 
+	view.clearInputs = func() {
+		for i := range form.GetFormItemCount() {
+			form.GetFormItem(i).(*tview.InputField).SetText("")
+		}
+	}
+
+	message := tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(tview.AlignCenter).
+		SetText("Set New AWS Access Keys")
+	view.setMessage = func(text string) {
+		message.SetText(text)
+	}
+
 	flex := tview.NewFlex().
 		SetDirection(tview.FlexRow).
-		AddItem(
-			tview.NewTextView().
-				SetTextAlign(tview.AlignCenter).
-				SetText("Set New AWS Access Keys"),
-							2, 1, false).
-		AddItem(tview.NewBox(), 3, 1, false). // Spacer
-		AddItem(accessKeyIDInput, 1, 1, true).
-		AddItem(tview.NewBox(), 1, 1, false). // Spacer
-		AddItem(secretAccessKeyInput, 1, 1, false).
-		AddItem(tview.NewBox(), 3, 1, false). // Spacer
-		AddItem(button, 3, 1, false)
+		AddItem(message, 2, 1, false).
+		AddItem(form, 0, 1, true)
 
 	flex.SetBorder(true)
 	flex.SetBorderPadding(2, 2, 2, 2)
-	flex.SetTitle(" [white]Change Profile ═════ [yellow]Set Access Keys ")
+	flex.SetTitle(authTabTitle(ipc.COMPONENT_SET_ACCESS_KEYS))
 
 	// Setting page
 	setting := tview.NewTextView().
-		SetText("Switching Profile...").
+		SetText("Validating access keys...\n\nPress Esc to cancel").
 		SetTextAlign(tview.AlignCenter)
+	view.setProgress = func(message string) {
+		setting.SetText(message + "\n\nPress Esc to cancel")
+	}
 	setting.SetBorder(true)
 	setting.SetBorderPadding(2, 2, 2, 2)
-	setting.SetTitle(" [white]Change Profile ═════ [yellow]Set Access Keys ")
+	setting.SetTitle(authTabTitle(ipc.COMPONENT_SET_ACCESS_KEYS))
 
 	// Success page
 	success := tview.NewFlex().
@@ -284,7 +413,7 @@ func NewSetAccessKeysView(handle *AppHandle) *SetAccessKeysView {
 		}), 3, 1, true)
 	success.SetBorder(true)
 	success.SetBorderPadding(2, 2, 2, 2)
-	success.SetTitle(" [white]Change Profile ═════ [yellow]Set Access Keys ")
+	success.SetTitle(authTabTitle(ipc.COMPONENT_SET_ACCESS_KEYS))
 
 	pages.AddPage("inputs", flex, true, true)
 	pages.AddPage("setting", setting, true, false)
@@ -292,28 +421,9 @@ func NewSetAccessKeysView(handle *AppHandle) *SetAccessKeysView {
 
 	pages.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
-		case tcell.KeyDown:
-			if accessKeyIDInput.HasFocus() {
-				// If the Access Key ID input has focus, move focus to the Secret Access Key input
-				view.handle.SetFocus(secretAccessKeyInput)
-				accessKeyIDInput.SetFieldBackgroundColor(tcell.ColorLightGray) // Reset background color
-				secretAccessKeyInput.SetFieldBackgroundColor(tcell.ColorWhite) // Reset background color
-			} else if secretAccessKeyInput.HasFocus() {
-				// If the Secret Access Key input has focus, move focus to the button
-				view.handle.SetFocus(button)
-				secretAccessKeyInput.SetFieldBackgroundColor(tcell.ColorLightGray) // Reset background color
-			}
-		case tcell.KeyUp:
-			if button.HasFocus() {
-				// If the button has focus, move focus back to the Secret Access Key input
-				view.handle.SetFocus(secretAccessKeyInput)
-				secretAccessKeyInput.SetFieldBackgroundColor(tcell.ColorWhite) // Reset background color
-			} else if secretAccessKeyInput.HasFocus() {
-				// If the Secret Access Key input has focus, move focus back to the Access Key ID input
-				view.handle.SetFocus(accessKeyIDInput)
-				secretAccessKeyInput.SetFieldBackgroundColor(tcell.ColorLightGray) // Reset background color
-				accessKeyIDInput.SetFieldBackgroundColor(tcell.ColorWhite)         // Reset background color
-			}
+		case tcell.KeyEscape:
+			// Abort the in flight request, the backend answers with a cancelled event
+			view.setting.Cancel()
 		}
 		return event
 	})
@@ -325,10 +435,30 @@ func NewSetAccessKeysView(handle *AppHandle) *SetAccessKeysView {
 }
 
 func (view *SetAccessKeysView) Render(event *ipc.Event) tview.Primitive {
-	if view.setting {
-		view.setting = false
-		view.ui.HidePage("setting")
+	if event.Action == ipc.ACTION_PROGRESS {
+		if progress, err := ipc.Handle[ipc.ProgressData](event); err == nil {
+			view.setProgress(progress.Message)
+		}
+		return view.ui
+	}
+
+	view.setting = nil
+	view.ui.HidePage("setting")
+	switch event.Action {
+	case ipc.ACTION_SET_ACCESS_KEYS:
+		view.clearInputs()
+		view.setMessage("Set New AWS Access Keys")
 		view.ui.ShowPage("success")
+	case ipc.ACTION_ACCESS_KEYS_INVALID:
+		if errData, err := ipc.Handle[ipc.ErrorData](event); err == nil {
+			view.setMessage("[red]" + tview.Escape(errData.Message))
+		}
+	case ipc.ACTION_CANCELLED:
+		view.setMessage("Validating the access keys was cancelled")
+	case ipc.ACTION_TIMED_OUT:
+		view.setMessage("Validating the access keys timed out")
+	case ipc.ACTION_FAILED:
+		view.setMessage("[red]Setting the access keys failed")
 	}
 
 	return view.ui
@@ -0,0 +1,95 @@
+package tui
+
+import (
+	"github.com/livinlefevreloca/canopy/internal/credserver"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+	"github.com/rivo/tview"
+)
+
+// CredentialsServerModal starts and stops the local endpoint serving the
+// current credentials, and shows how to point tools at it.
+type CredentialsServerModal struct {
+	ui       tview.Primitive
+	name     string
+	handle   *AppHandle
+	status   *tview.TextView
+	button   *tview.Button
+	toggling bool // A start or stop is in flight
+}
+
+func NewCredentialsServerModal(handle *AppHandle) *CredentialsServerModal {
+	modal := CredentialsServerModal{
+		ui:     nil,
+		name:   ipc.COMPONENT_CREDENTIALS_SERVER,
+		handle: handle,
+	}
+
+	modal.status = tview.NewTextView().
+		SetDynamicColors(true).
+		SetWordWrap(false).
+		SetTextAlign(tview.AlignLeft)
+	modal.button = tview.NewButton("Start").SetSelectedFunc(func() {
+		if modal.toggling {
+			return
+		}
+		modal.toggling = true
+		modal.handle.SendTrigger(modal.name, ipc.ACTION_TOGGLE_CREDENTIALS_SERVER, nil)
+	})
+	modal.render(ipc.CredentialsServerData{Running: false})
+
+	flex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(modal.status, 0, 1, false).
+		AddItem(tview.NewBox(), 1, 1, false). // Spacer
+		AddItem(modal.button, 3, 1, true)
+	flex.SetBorder(true)
+	flex.SetBorderPadding(2, 2, 2, 2)
+	flex.SetTitle("[yellow]Credentials Endpoint")
+
+	modal.handle.SetSubscription(modal.name, &modal)
+	modal.ui = makeModal(flex)
+	return &modal
+}
+
+// Opened asks for the status, the endpoint may have been toggled by another window.
+func (modal *CredentialsServerModal) Opened() {
+	modal.handle.SendTrigger(modal.name, ipc.ACTION_GET_CREDENTIALS_SERVER, nil)
+}
+
+func (modal *CredentialsServerModal) Closed() {}
+
+func (modal *CredentialsServerModal) render(data ipc.CredentialsServerData) {
+	if !data.Running {
+		modal.status.SetText("The endpoint is [red]stopped[white].\n\n" +
+			"Start it to let docker containers and other local tools use the\n" +
+			"identity that is active in canopy, without copying keys.")
+		modal.button.SetLabel("Start")
+		return
+	}
+	modal.status.SetText("The endpoint is [green]running[white] and serves the active identity.\n\n" +
+		"Point tools at it with:\n\n" +
+		"[yellow]export " + credserver.ENV_FULL_URI + "=" + data.URL + "\n" +
+		"export " + credserver.ENV_AUTHORIZATION_TOKEN + "=" + data.Token + "[white]\n\n" +
+		"Containers on the default bridge network cannot reach it, run them with\n" +
+		"--network host. See canopy serve-credentials --help for other setups.")
+	modal.button.SetLabel("Stop")
+}
+
+func (modal *CredentialsServerModal) Render(event *ipc.Event) tview.Primitive {
+	switch event.Action {
+	case ipc.ACTION_TOGGLE_CREDENTIALS_SERVER:
+		modal.toggling = false
+		fallthrough
+	case ipc.ACTION_GET_CREDENTIALS_SERVER:
+		if data, err := ipc.Handle[ipc.CredentialsServerData](event); err == nil {
+			modal.render(data)
+		}
+	case ipc.ACTION_CANCELLED, ipc.ACTION_TIMED_OUT, ipc.ACTION_FAILED:
+		modal.toggling = false
+	}
+	return modal.ui
+}
+
+func (modal *CredentialsServerModal) GetName() string {
+	return modal.name
+}
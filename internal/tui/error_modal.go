@@ -8,24 +8,26 @@ import (
 )
 
 type ErrorModal struct {
-	ui      tview.Primitive
-	name    string // Name of the modal, used for identification
-	handle  *AppHandle
-	message string
+	ui          tview.Primitive
+	messageView *tview.TextView // Text view displaying the error message
+	name        string          // Name of the modal, used for identification
+	handle      *AppHandle
+	message     string
 }
 
 func NewErrorModal(handle *AppHandle) *ErrorModal {
 	errorModal := &ErrorModal{
-		ui:      nil,
-		name:    ipc.COMPONENT_ERROR_MODAL,
-		handle:  handle,
-		message: "",
+		ui:          nil,
+		messageView: tview.NewTextView().SetTextAlign(tview.AlignCenter).SetText(""),
+		name:        ipc.COMPONENT_ERROR_MODAL,
+		handle:      handle,
+		message:     "",
 	}
 
 	flex := tview.NewFlex().
 		SetDirection(tview.FlexRow).
 		AddItem(tview.NewTextView().SetTextAlign(tview.AlignCenter).SetText("An error occurred!"), 0, 1, false).
-		AddItem(tview.NewTextView().SetTextAlign(tview.AlignCenter).SetText(""), 0, 1, false).
+		AddItem(errorModal.messageView, 0, 1, false).
 		AddItem(tview.NewButton("Ok").SetSelectedFunc(func() {
 			errorModal.handle.PassEvent(ipc.Event{
 				Component: ipc.COMPONENT_TUI,
@@ -35,13 +37,24 @@ func NewErrorModal(handle *AppHandle) *ErrorModal {
 
 		}), 1, 1, false)
 
+	errorModal.handle.SetSubscription(errorModal.GetName(), errorModal)
 	errorModal.ui = flex
 	return errorModal
 }
 
 func (em *ErrorModal) Render(events *ipc.Event) tview.Primitive {
-	errData := events.Data.(ipc.ErrorData)
-	em.ui.(*tview.TextView).SetText(fmt.Sprintf("Error: %s", errData.Message))
+	errData, err := ipc.Handle[ipc.ErrorData](events)
+	if err != nil {
+		// Showing an error about the error modal in the error modal is the best we can do
+		errData = ipc.ErrorData{Message: err.Error()}
+	}
+	em.message = errData.Message
+	text := fmt.Sprintf("Error: %s", em.message)
+	if events.RequestID != "" {
+		// Lets the user quote the request so it can be found in the logs
+		text += fmt.Sprintf("\n\nRequest ID: %s", events.RequestID)
+	}
+	em.messageView.SetText(text)
 	return em.ui
 }
 
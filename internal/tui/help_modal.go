@@ -16,8 +16,13 @@ func NewHelpModal(handle *AppHandle) *HelpModal {
 	- Press [yellow]'ctrl-h'[white] to show this help.
 	- Press [yellow]'ctrl-c'[white] to quit the application.
 	- Press [yellow]'ctrl-a'[white] to open the authentication modal.
+	- Press [yellow]'Tab'[white] to switch between profiles, access keys, assuming a role, SSO accounts
+	  and editing the profiles of the AWS config file.
+	- Press [yellow]'ctrl-e'[white] to serve the active credentials to local tools.
+	- Press [yellow]'ctrl-r'[white] to switch the region of the active identity.
 	- Use arrow keys to navigate through the UI.
 	- Press [yellow]'Enter'[white] to select an option.
+	- Press [yellow]'Esc'[white] to cancel a running request in a modal.
 	`
 
 	textView := tview.NewTextView().
@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+	"github.com/rivo/tview"
+)
+
+// Length of the codes MFA devices generate
+const MFA_CODE_LENGTH = 6
+
+// MFAModal asks for the code of an MFA device when the backend needs one to
+// load credentials. The backend waits for the answer, so closing the modal
+// without a code tells it to give up. Several requests can wait for a code at
+// once, their prompts are answered one after the other.
+type MFAModal struct {
+	ui         tview.Primitive
+	name       string
+	handle     *AppHandle
+	setMessage func(string) // Function to set the message above the code input
+	code       *tview.InputField
+	prompts    []ipc.MFARequestData // Prompts waiting for an answer, the first one is shown
+}
+
+func NewMFAModal(handle *AppHandle) *MFAModal {
+	modal := MFAModal{
+		ui:      nil,
+		name:    ipc.COMPONENT_MFA_MODAL,
+		handle:  handle,
+		prompts: make([]ipc.MFARequestData, 0),
+	}
+
+	form := tview.NewForm().
+		SetFieldTextColor(tcell.ColorBlack).
+		SetFieldBackgroundColor(tcell.ColorWhite).
+		AddInputField("MFA Code: ", "", MFA_CODE_LENGTH+2, tview.InputFieldInteger, nil)
+	modal.code = form.GetFormItem(0).(*tview.InputField)
+	form.AddButton("Submit", func() {
+		code := strings.TrimSpace(modal.code.GetText())
+		if len(code) != MFA_CODE_LENGTH {
+			modal.setMessage("The code must be 6 digits")
+			return
+		}
+		modal.answer(ipc.MFATokenData{Token: code})
+	})
+	form.AddButton("Cancel", func() {
+		modal.answer(ipc.MFATokenData{Cancelled: true})
+	})
+	form.SetCancelFunc(func() {
+		modal.answer(ipc.MFATokenData{Cancelled: true})
+	})
+
+	message := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetText("Enter the code from your MFA device")
+	modal.setMessage = func(text string) {
+		message.SetText(text)
+	}
+
+	flex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(message, 3, 1, false).
+		AddItem(form, 0, 1, true)
+	flex.SetBorder(true)
+	flex.SetBorderPadding(2, 2, 2, 2)
+	flex.SetTitle("[yellow]MFA Required")
+
+	modal.handle.SetSubscription(modal.name, &modal)
+	modal.ui = makeModal(flex)
+	return &modal
+}
+
+// Send the answer for the shown prompt and show the next one. The backend
+// tells every tui once the prompt is closed, the modal closes with the last.
+func (modal *MFAModal) answer(tokenData ipc.MFATokenData) {
+	if len(modal.prompts) == 0 {
+		return // Already answered
+	}
+	tokenData.PromptID = modal.prompts[0].PromptID
+	modal.prompts = modal.prompts[1:]
+	modal.code.SetText("")
+	modal.showPrompt()
+	modal.handle.SendTrigger(modal.name, ipc.ACTION_PROVIDE_MFA_TOKEN, tokenData)
+}
+
+// Show which device the first waiting prompt needs a code of.
+func (modal *MFAModal) showPrompt() {
+	if len(modal.prompts) == 0 {
+		modal.setMessage("Enter the code from your MFA device")
+		return
+	}
+	message := "Enter the code from your MFA device\n" + modal.prompts[0].SerialNumber
+	if waiting := len(modal.prompts) - 1; waiting > 0 {
+		message += fmt.Sprintf("\n%d more waiting", waiting)
+	}
+	modal.setMessage(message)
+}
+
+// Forget a prompt the backend stopped waiting on and close the modal after the last one.
+func (modal *MFAModal) promptClosed(id string) {
+	for i, prompt := range modal.prompts {
+		if prompt.PromptID == id {
+			modal.prompts = slices.Delete(modal.prompts, i, i+1)
+			if i == 0 {
+				modal.code.SetText("") // The code was for the closed prompt
+			}
+			modal.showPrompt()
+			break
+		}
+	}
+	if len(modal.prompts) == 0 {
+		modal.handle.PassEvent(ipc.Event{
+			Component: ipc.COMPONENT_TUI,
+			Action:    ipc.ACTION_CLOSE_MFA_MODAL,
+			Data:      nil,
+		})
+	}
+}
+
+func (modal *MFAModal) Render(event *ipc.Event) tview.Primitive {
+	switch event.Action {
+	case ipc.ACTION_REQUEST_MFA_TOKEN:
+		request, err := ipc.Handle[ipc.MFARequestData](event)
+		if err != nil {
+			modal.handle.ShowError(err.Error())
+			return modal.ui
+		}
+		if len(modal.prompts) == 0 {
+			modal.code.SetText("")
+		}
+		modal.prompts = append(modal.prompts, request)
+		modal.showPrompt()
+	case ipc.ACTION_MFA_PROMPT_CLOSED:
+		if closed, err := ipc.Handle[ipc.MFAPromptClosedData](event); err == nil {
+			modal.promptClosed(closed.PromptID)
+		}
+	case ipc.ACTION_PROVIDE_MFA_TOKEN:
+		// The backend has the code, it tells every tui once the prompt is closed
+	}
+	return modal.ui
+}
+
+func (modal *MFAModal) GetName() string {
+	return modal.name
+}
@@ -0,0 +1,259 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+	"github.com/rivo/tview"
+)
+
+// Kinds of section the editor can create, in the order of the kind drop down
+var configSectionKinds = []string{awsAuth.CONFIG_SECTION_PROFILE, awsAuth.CONFIG_SECTION_SSO_SESSION}
+
+// Shown above the editor when nothing else is
+const PROFILE_EDITOR_HINT = "Select a section to edit, Shift-Tab moves between fields, Esc goes back to the list"
+
+// ProfileEditorView creates, edits, clones and deletes the profiles and
+// sso-sessions of the AWS config file. Settings are edited as "key = value"
+// lines and the backend validates them before the file is written.
+type ProfileEditorView struct {
+	ui         *tview.Pages
+	name       string
+	handle     *AppHandle
+	setMessage func(string) // Function to set the message above the editor
+	sections   *tview.List
+	form       *tview.Form
+	kind       *tview.DropDown
+	original   string             // Name of the section being edited, empty for a new one
+	confirm    string             // Section the user pressed Delete on once, it is deleted on the second press
+	saving     *ipc.TriggerHandle // The in flight request, if any
+}
+
+func NewProfileEditorView(handle *AppHandle) *ProfileEditorView {
+	view := ProfileEditorView{
+		ui:     nil,
+		name:   ipc.COMPONENT_PROFILE_EDITOR,
+		handle: handle,
+	}
+
+	view.sections = tview.NewList().ShowSecondaryText(false)
+	view.sections.SetBorder(true).SetTitle("Config File")
+
+	view.form = tview.NewForm().
+		SetItemPadding(0).
+		SetFieldTextColor(tcell.ColorBlack).
+		SetFieldBackgroundColor(tcell.ColorWhite).
+		AddInputField("Name: ", "", 30, nil, nil).
+		AddDropDown("Kind: ", configSectionKinds, 0, nil).
+		AddTextArea("Settings: ", "", 0, 7, 0, nil)
+	view.kind = view.form.GetFormItem(1).(*tview.DropDown)
+	view.form.AddButton("Save", view.save)
+	view.form.AddButton("New", func() {
+		view.edit(awsAuth.ConfigSection{Kind: awsAuth.CONFIG_SECTION_PROFILE}, "")
+		view.setMessage("Enter the name and settings of the new section")
+		view.handle.SetFocus(view.form.SetFocus(0))
+	})
+	view.form.AddButton("Clone", func() {
+		if view.original == "" {
+			view.setMessage("Select a section to clone first")
+			return
+		}
+		view.original = ""
+		view.kind.SetDisabled(false)
+		name := view.form.GetFormItem(0).(*tview.InputField)
+		name.SetText(name.GetText() + "-copy")
+		view.setMessage("Save the copy under a new name")
+		view.handle.SetFocus(view.form.SetFocus(0))
+	})
+	view.form.AddButton("Delete", func() {
+		if view.original == "" {
+			view.setMessage("Select a section to delete first")
+			return
+		}
+		kind := view.selectedKind()
+		if view.confirm != kind+" "+view.original {
+			view.confirm = kind + " " + view.original
+			view.setMessage("[red]Press Delete again to delete " + tview.Escape(view.confirm))
+			return
+		}
+		view.confirm = ""
+		view.saving = view.handle.SendTrigger(view.name, ipc.ACTION_DELETE_CONFIG_SECTION, ipc.ConfigSectionData{
+			Kind: kind,
+			Name: view.original,
+		})
+	})
+	view.form.SetBorder(true).SetTitle("Section")
+	view.form.SetBorderPadding(0, 0, 1, 1)
+
+	message := tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(tview.AlignCenter).
+		SetText(PROFILE_EDITOR_HINT)
+	view.setMessage = func(text string) {
+		message.SetText(text)
+	}
+
+	editor := tview.NewFlex().
+		AddItem(view.sections, 30, 1, true).
+		AddItem(view.form, 0, 1, false)
+
+	flex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(message, 1, 1, false).
+		AddItem(editor, 0, 1, true)
+	flex.SetBorder(true)
+	flex.SetBorderPadding(1, 1, 2, 2)
+	flex.SetTitle(authTabTitle(ipc.COMPONENT_PROFILE_EDITOR))
+
+	pages := tview.NewPages()
+	pages.AddPage("editor", flex, true, true)
+	pages.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			if view.saving != nil {
+				// Abort the in flight request, the backend answers with a cancelled event
+				view.saving.Cancel()
+				return nil
+			}
+			if view.form.HasFocus() {
+				view.handle.SetFocus(view.sections)
+				return nil
+			}
+		}
+		return event
+	})
+
+	view.loadSections()
+	view.handle.SetSubscription(view.name, &view)
+	view.handle.Subscribe(ipc.TOPIC_PROFILES_CHANGED, &view)
+	view.ui = pages
+
+	return &view
+}
+
+// Fill the section list from the config file.
+func (view *ProfileEditorView) loadSections() {
+	view.sections.Clear()
+	sections, err := awsAuth.LoadConfigSections()
+	if err != nil {
+		view.setMessage("[red]Failed to read the AWS config: " + tview.Escape(err.Error()))
+		return
+	}
+	for _, section := range sections {
+		view.sections.AddItem(section.Kind+" "+section.Name, "", 0, func() {
+			view.edit(section, section.Name)
+			view.setMessage("Editing " + tview.Escape(section.Kind+" "+section.Name))
+			view.handle.SetFocus(view.form.SetFocus(2))
+		})
+	}
+}
+
+// Show a section in the form. The kind of a section that exists cannot be changed.
+func (view *ProfileEditorView) edit(section awsAuth.ConfigSection, original string) {
+	view.original = original
+	view.confirm = ""
+	lines := make([]string, 0, len(section.Properties))
+	for _, property := range section.Properties {
+		lines = append(lines, property[0]+" = "+property[1])
+	}
+	view.form.GetFormItem(0).(*tview.InputField).SetText(section.Name)
+	for i, kind := range configSectionKinds {
+		if kind == section.Kind {
+			view.kind.SetCurrentOption(i)
+		}
+	}
+	view.kind.SetDisabled(original != "")
+	view.form.GetFormItem(2).(*tview.TextArea).SetText(strings.Join(lines, "\n"), false)
+}
+
+func (view *ProfileEditorView) selectedKind() string {
+	_, kind := view.kind.GetCurrentOption()
+	return kind
+}
+
+func (view *ProfileEditorView) save() {
+	name := strings.TrimSpace(view.form.GetFormItem(0).(*tview.InputField).GetText())
+	properties, err := parseSettings(view.form.GetFormItem(2).(*tview.TextArea).GetText())
+	if err != nil {
+		view.setMessage("[red]" + tview.Escape(err.Error()))
+		return
+	}
+	if name == "" {
+		view.setMessage("[red]A name is required")
+		return
+	}
+	view.confirm = ""
+	view.setMessage("Saving " + view.selectedKind() + " " + name + "...")
+	view.saving = view.handle.SendTrigger(view.name, ipc.ACTION_SAVE_CONFIG_SECTION, ipc.ConfigSectionData{
+		Kind:       view.selectedKind(),
+		Name:       name,
+		Original:   view.original,
+		Properties: properties,
+	})
+}
+
+// Parse "key = value" lines. Blank lines are skipped.
+func parseSettings(text string) ([]ipc.ConfigPropertyData, error) {
+	properties := make([]ipc.ConfigPropertyData, 0)
+	for i, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d of the settings is not key = value", i+1)
+		}
+		properties = append(properties, ipc.ConfigPropertyData{
+			Key:   strings.ToLower(strings.TrimSpace(key)),
+			Value: strings.TrimSpace(value),
+		})
+	}
+	return properties, nil
+}
+
+func (view *ProfileEditorView) Render(event *ipc.Event) tview.Primitive {
+	switch event.Action {
+	case ipc.ACTION_PROGRESS:
+		if progress, err := ipc.Handle[ipc.ProgressData](event); err == nil {
+			view.setMessage(progress.Message)
+		}
+		return view.ui
+	case ipc.ACTION_PROFILES_CHANGED:
+		view.loadSections()
+		return view.ui
+	}
+
+	view.saving = nil
+	switch event.Action {
+	case ipc.ACTION_SAVE_CONFIG_SECTION:
+		if saved, err := ipc.Handle[ipc.ConfigSectionData](event); err == nil {
+			view.original = saved.Original
+			view.kind.SetDisabled(true)
+			view.setMessage("Saved " + saved.Kind + " " + saved.Name)
+		}
+	case ipc.ACTION_DELETE_CONFIG_SECTION:
+		if deleted, err := ipc.Handle[ipc.ConfigSectionData](event); err == nil {
+			view.edit(awsAuth.ConfigSection{Kind: awsAuth.CONFIG_SECTION_PROFILE}, "")
+			view.setMessage("Deleted " + deleted.Kind + " " + deleted.Name)
+			view.handle.SetFocus(view.sections)
+		}
+	case ipc.ACTION_CONFIG_SECTION_INVALID:
+		if errData, err := ipc.Handle[ipc.ErrorData](event); err == nil {
+			view.setMessage("[red]" + tview.Escape(errData.Message))
+		}
+	case ipc.ACTION_CANCELLED:
+		view.setMessage("Saving the config file was cancelled")
+	case ipc.ACTION_TIMED_OUT:
+		view.setMessage("Saving the config file timed out")
+	case ipc.ACTION_FAILED:
+		view.setMessage("[red]Saving the config file failed")
+	}
+	return view.ui
+}
+
+func (view *ProfileEditorView) GetName() string {
+	return view.name
+}
@@ -0,0 +1,143 @@
+package tui
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+	"github.com/rivo/tview"
+)
+
+// RegionPickerModal lists the regions enabled for the account and switches
+// the active identity to the selected one.
+type RegionPickerModal struct {
+	ui         tview.Primitive
+	name       string
+	handle     *AppHandle
+	setMessage func(string) // Function to set the message above the region list
+	regions    *tview.List
+	loading    *ipc.TriggerHandle // The in flight request, if any
+}
+
+func NewRegionPickerModal(handle *AppHandle) *RegionPickerModal {
+	modal := RegionPickerModal{
+		ui:     nil,
+		name:   ipc.COMPONENT_REGION_PICKER,
+		handle: handle,
+	}
+
+	message := tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(tview.AlignCenter)
+	modal.setMessage = func(text string) {
+		message.SetText(text)
+	}
+	modal.regions = tview.NewList().ShowSecondaryText(false)
+
+	flex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(message, 2, 1, false).
+		AddItem(modal.regions, 0, 1, true)
+	flex.SetBorder(true)
+	flex.SetBorderPadding(1, 1, 2, 2)
+	flex.SetTitle("[yellow]Region")
+	flex.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			if modal.loading != nil {
+				// Abort the in flight request, the backend answers with a cancelled event
+				modal.loading.Cancel()
+				return nil
+			}
+			modal.close()
+			return nil
+		}
+		return event
+	})
+
+	modal.handle.SetSubscription(modal.name, &modal)
+	modal.ui = makeModal(flex)
+	return &modal
+}
+
+// Opened lists the regions again, the identity may have changed since.
+func (modal *RegionPickerModal) Opened() {
+	modal.regions.Clear()
+	modal.setMessage("Loading regions...")
+	modal.loading = modal.handle.SendTrigger(modal.name, ipc.ACTION_LIST_REGIONS, nil)
+}
+
+// Closed abandons a list that is still loading.
+func (modal *RegionPickerModal) Closed() {
+	modal.loading.Cancel()
+}
+
+func (modal *RegionPickerModal) showRegions(regionsData ipc.RegionsData) {
+	modal.regions.Clear()
+	for _, region := range regionsData.Regions {
+		label := region.Name
+		if region.OptIn {
+			label += " [gray](opt-in)[white]"
+		}
+		if region.Name == regionsData.Current {
+			label += " [yellow](current)[white]"
+		}
+		modal.regions.AddItem(label, "", 0, func() {
+			if region.Name == regionsData.Current {
+				modal.close()
+				return
+			}
+			modal.loading = modal.handle.SendTrigger(modal.name, ipc.ACTION_CHANGE_REGION, ipc.ChangeRegionData{
+				Region: region.Name,
+			})
+		})
+		if region.Name == regionsData.Current {
+			modal.regions.SetCurrentItem(modal.regions.GetItemCount() - 1)
+		}
+	}
+	if regionsData.Offline != "" {
+		modal.setMessage("[red]Could not list the enabled regions, every region is shown[white]\n" + tview.Escape(regionsData.Offline))
+		return
+	}
+	modal.setMessage("Select a Region to Switch To")
+}
+
+func (modal *RegionPickerModal) close() {
+	modal.handle.PassEvent(ipc.Event{
+		Component: ipc.COMPONENT_TUI,
+		Action:    ipc.ACTION_CLOSE_REGION_PICKER,
+		Data:      nil,
+	})
+}
+
+func (modal *RegionPickerModal) Render(event *ipc.Event) tview.Primitive {
+	if event.Action == ipc.ACTION_PROGRESS {
+		if progress, err := ipc.Handle[ipc.ProgressData](event); err == nil {
+			modal.setMessage(progress.Message + "\nPress Esc to cancel")
+		}
+		return modal.ui
+	}
+
+	modal.loading = nil
+	switch event.Action {
+	case ipc.ACTION_LIST_REGIONS:
+		if regionsData, err := ipc.Handle[ipc.RegionsData](event); err == nil {
+			modal.showRegions(regionsData)
+		}
+	case ipc.ACTION_CHANGE_REGION:
+		modal.close()
+	case ipc.ACTION_CANCELLED:
+		modal.setMessage("Request was cancelled\nPress Esc to close")
+	case ipc.ACTION_TIMED_OUT:
+		modal.setMessage("Request timed out\nPress Esc to close")
+	case ipc.ACTION_FAILED:
+		if failed, err := ipc.Handle[ipc.FailedData](event); err == nil && failed.Action == ipc.ACTION_CHANGE_REGION {
+			modal.setMessage("[red]Switching the region failed[white], select a region to try again")
+		} else {
+			modal.setMessage("[red]Could not load the regions")
+		}
+	}
+	return modal.ui
+}
+
+func (modal *RegionPickerModal) GetName() string {
+	return modal.name
+}
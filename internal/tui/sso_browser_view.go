@@ -0,0 +1,225 @@
+package tui
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
+	"github.com/livinlefevreloca/canopy/internal/ipc"
+	"github.com/rivo/tview"
+)
+
+// Characters that are replaced when suggesting a profile name for a role
+var profileNameReplacer = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// SSOBrowserView lists the accounts and roles of an SSO session so any of
+// them can be used, or saved as a profile, without writing the profile by hand.
+type SSOBrowserView struct {
+	ui         *tview.Pages
+	name       string
+	handle     *AppHandle
+	setMessage func(string) // Function to set the message above the lists
+	sessions   *tview.List
+	accounts   *tview.List
+	roles      *tview.List
+	form       *tview.Form
+	session    string             // The selected session
+	account    ipc.SSOAccountData // The selected account
+	role       string             // The selected role
+	loading    *ipc.TriggerHandle // The in flight request, if any
+}
+
+func NewSSOBrowserView(handle *AppHandle) *SSOBrowserView {
+	view := SSOBrowserView{
+		ui:     nil,
+		name:   ipc.COMPONENT_SSO_BROWSER,
+		handle: handle,
+	}
+
+	view.sessions = tview.NewList().ShowSecondaryText(false)
+	view.sessions.SetBorder(true).SetTitle("Sessions")
+
+	view.accounts = tview.NewList().ShowSecondaryText(false)
+	view.accounts.SetBorder(true).SetTitle("Accounts")
+	view.roles = tview.NewList().ShowSecondaryText(false)
+	view.roles.SetBorder(true).SetTitle("Roles")
+
+	view.form = tview.NewForm().
+		SetHorizontal(true).
+		SetFieldTextColor(tcell.ColorBlack).
+		SetFieldBackgroundColor(tcell.ColorWhite).
+		AddInputField("Profile Name: ", "", 30, nil, nil)
+	view.form.AddButton("Use Role", func() {
+		if view.role == "" {
+			view.setMessage("Select a role first")
+			return
+		}
+		view.setMessage("Switching to " + view.role + " in " + view.account.Name + "...")
+		view.loading = view.handle.SendTrigger(view.name, ipc.ACTION_USE_SSO_ROLE, view.selectedRole(""))
+	})
+	view.form.AddButton("Save Profile", func() {
+		profile := strings.TrimSpace(view.form.GetFormItem(0).(*tview.InputField).GetText())
+		if view.role == "" || profile == "" {
+			view.setMessage("Select a role and enter a profile name first")
+			return
+		}
+		view.loading = view.handle.SendTrigger(view.name, ipc.ACTION_SAVE_SSO_PROFILE, view.selectedRole(profile))
+	})
+
+	message := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetText("Select an SSO Session to Browse")
+	view.setMessage = func(text string) {
+		message.SetText(text)
+	}
+	view.loadSessions()
+
+	lists := tview.NewFlex().
+		AddItem(view.sessions, 0, 1, true).
+		AddItem(view.accounts, 0, 1, false).
+		AddItem(view.roles, 0, 1, false)
+
+	flex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(message, 1, 1, false).
+		AddItem(lists, 0, 1, true).
+		AddItem(view.form, 3, 1, false)
+	flex.SetBorder(true)
+	flex.SetBorderPadding(1, 1, 2, 2)
+	flex.SetTitle(authTabTitle(ipc.COMPONENT_SSO_BROWSER))
+
+	pages := tview.NewPages()
+	pages.AddPage("browser", flex, true, true)
+	pages.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			if view.loading != nil {
+				// Abort the in flight request, the backend answers with a cancelled event
+				view.loading.Cancel()
+				return nil
+			}
+			// Step back to the column before the focused one
+			switch {
+			case view.form.HasFocus():
+				view.handle.SetFocus(view.roles)
+			case view.roles.HasFocus():
+				view.handle.SetFocus(view.accounts)
+			case view.accounts.HasFocus():
+				view.handle.SetFocus(view.sessions)
+			}
+			return nil
+		}
+		return event
+	})
+
+	view.handle.SetSubscription(view.name, &view)
+	view.handle.Subscribe(ipc.TOPIC_PROFILES_CHANGED, &view)
+	view.ui = pages
+
+	return &view
+}
+
+// Fill the session list from the AWS config and credentials files.
+func (view *SSOBrowserView) loadSessions() {
+	view.sessions.Clear()
+	profiles, err := awsAuth.LoadProfiles()
+	if err != nil {
+		view.setMessage("Failed to read the AWS config: " + err.Error())
+		return
+	}
+	for _, session := range profiles.SSOLogins() {
+		label := session.Name
+		if label == "" {
+			label = session.StartURL + " (legacy)"
+		}
+		view.sessions.AddItem(label, "", 0, func() {
+			view.session = session.Key()
+			view.account = ipc.SSOAccountData{}
+			view.role = ""
+			view.accounts.Clear()
+			view.roles.Clear()
+			view.setMessage("Loading accounts...")
+			view.loading = view.handle.SendTrigger(view.name, ipc.ACTION_LIST_SSO_ACCOUNTS, ipc.SSOSessionData{
+				Session: view.session,
+			})
+		})
+	}
+}
+
+func (view *SSOBrowserView) selectedRole(profile string) ipc.SSORoleData {
+	return ipc.SSORoleData{
+		Session:   view.session,
+		AccountID: view.account.AccountID,
+		RoleName:  view.role,
+		Profile:   profile,
+	}
+}
+
+func (view *SSOBrowserView) Render(event *ipc.Event) tview.Primitive {
+	switch event.Action {
+	case ipc.ACTION_PROGRESS:
+		if progress, err := ipc.Handle[ipc.ProgressData](event); err == nil {
+			view.setMessage(progress.Message)
+		}
+		return view.ui
+	case ipc.ACTION_PROFILES_CHANGED:
+		view.loadSessions()
+		return view.ui
+	}
+
+	view.loading = nil
+	switch event.Action {
+	case ipc.ACTION_LIST_SSO_ACCOUNTS:
+		accountsData, err := ipc.Handle[ipc.SSOAccountsData](event)
+		if err != nil || accountsData.Session != view.session {
+			return view.ui // A session that is no longer selected
+		}
+		view.accounts.Clear()
+		for _, account := range accountsData.Accounts {
+			view.accounts.AddItem(account.Name+" ("+account.AccountID+")", "", 0, func() {
+				view.account = account
+				view.role = ""
+				view.roles.Clear()
+				view.setMessage("Loading roles...")
+				view.loading = view.handle.SendTrigger(view.name, ipc.ACTION_LIST_SSO_ROLES, view.selectedRole(""))
+			})
+		}
+		view.setMessage("Select an Account")
+		view.handle.SetFocus(view.accounts)
+	case ipc.ACTION_LIST_SSO_ROLES:
+		rolesData, err := ipc.Handle[ipc.SSORolesData](event)
+		if err != nil || rolesData.AccountID != view.account.AccountID {
+			return view.ui
+		}
+		view.roles.Clear()
+		for _, role := range rolesData.Roles {
+			view.roles.AddItem(role, "", 0, func() {
+				view.role = role
+				suggested := profileNameReplacer.ReplaceAllString(view.account.Name+"-"+role, "-")
+				view.form.GetFormItem(0).(*tview.InputField).SetText(strings.ToLower(suggested))
+				view.setMessage("Use " + role + " now, or save it as a profile")
+				view.handle.SetFocus(view.form)
+			})
+		}
+		view.setMessage("Select a Role")
+		view.handle.SetFocus(view.roles)
+	case ipc.ACTION_USE_SSO_ROLE:
+		view.setMessage("Switched to " + view.role + " in " + view.account.Name)
+	case ipc.ACTION_SAVE_SSO_PROFILE:
+		if saved, err := ipc.Handle[ipc.SSORoleData](event); err == nil {
+			view.setMessage("Saved profile " + saved.Profile)
+		}
+	case ipc.ACTION_CANCELLED:
+		view.setMessage("Request was cancelled")
+	case ipc.ACTION_TIMED_OUT:
+		view.setMessage("Request timed out")
+	case ipc.ACTION_FAILED:
+		view.setMessage("Request failed")
+	}
+	return view.ui
+}
+
+func (view *SSOBrowserView) GetName() string {
+	return view.name
+}
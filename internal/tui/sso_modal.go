@@ -2,6 +2,7 @@ package tui
 
 import (
 	"log/slog"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	awsAuth "github.com/livinlefevreloca/canopy/internal/aws/auth"
@@ -15,7 +16,11 @@ type SSOReauthenticationModal struct {
 	name            string
 	handle          *AppHandle
 	setMessage      func(string) // Function to set the message in the UI
+	setProgress     func(string) // Function to set the message on the refreshing page
 	selectedProfile string
+	profiles        *tview.List        // The SSO profiles
+	button          *tview.Button      // Reauthenticates the selected profile
+	refresh         *ipc.TriggerHandle // The in flight refresh, if any
 }
 
 func NewSSOReauthenticationModal(handle *AppHandle) *SSOReauthenticationModal {
@@ -24,6 +29,7 @@ func NewSSOReauthenticationModal(handle *AppHandle) *SSOReauthenticationModal {
 		name:            ipc.COMPONENT_REFRESH_SSO,
 		handle:          handle,
 		setMessage:      nil,
+		setProgress:     nil,
 		selectedProfile: "",
 	}
 
@@ -32,23 +38,20 @@ func NewSSOReauthenticationModal(handle *AppHandle) *SSOReauthenticationModal {
 	// inputs page
 	button := tview.NewButton("Rerefresh SSO").SetSelectedFunc(func() {
 		if modal.selectedProfile != "" {
-			modal.handle.SendTrigger(modal.GetName(), ipc.ACTION_REAUTHENTICATE_SSO, ipc.ReauthenticateSSOData{
+			modal.refresh = modal.handle.SendTrigger(modal.GetName(), ipc.ACTION_REAUTHENTICATE_SSO, ipc.ReauthenticateSSOData{
 				Profile: modal.selectedProfile,
 			})
+			modal.setProgress("Refreshing SSO Credentials...")
 			modal.pages.ShowPage("refreshing")
 			modal.selectedProfile = "" // Reset selected profile after reauthentication
 		}
 	})
 
+	modal.button = button
 	profileList := tview.NewList()
 	profileList.ShowSecondaryText(false)
-
-	for _, profile := range awsAuth.GetAvailableProfiles() {
-		profileList.AddItem(profile, "", 0, func() {
-			modal.selectedProfile = profile
-			modal.handle.SetFocus(button)
-		})
-	}
+	modal.profiles = profileList
+	modal.loadProfiles()
 
 	textView := tview.NewTextView().
 		SetTextAlign(tview.AlignCenter).
@@ -70,9 +73,13 @@ func NewSSOReauthenticationModal(handle *AppHandle) *SSOReauthenticationModal {
 
 	// reauthenticating page
 	reauth := tview.NewTextView().
-		SetText("Refreshing SSO Credentials...").
+		SetText("Refreshing SSO Credentials...\n\nPress Esc to cancel").
 		SetTextAlign(tview.AlignCenter)
 
+	modal.setProgress = func(message string) {
+		reauth.SetText(message + "\n\nPress Esc to cancel")
+	}
+
 	reauth.SetBorder(true)
 	reauth.SetBorderPadding(2, 2, 2, 2)
 	flex.SetTitle("[yellow]SSO Authentication")
@@ -110,32 +117,87 @@ func NewSSOReauthenticationModal(handle *AppHandle) *SSOReauthenticationModal {
 				// If the button has focus, move focus back to the profile list
 				modal.handle.SetFocus(profileList)
 			}
+		case tcell.KeyEscape:
+			// Abort the in flight refresh, the backend answers with a cancelled event
+			modal.refresh.Cancel()
 		}
 		return event
 	})
 
 	modal.handle.SetSubscription(modal.GetName(), &modal)
+	modal.handle.Subscribe(ipc.TOPIC_PROFILES_CHANGED, &modal)
 	modal.pages = pages
 	modal.ui = makeModal(pages)
 
 	return &modal
 }
 
+// Fill the profile list with the SSO profiles, only they can be reauthenticated.
+func (modal *SSOReauthenticationModal) loadProfiles() {
+	modal.profiles.Clear()
+	modal.selectedProfile = ""
+	for _, profile := range awsAuth.GetAvailableProfiles() {
+		if profile.AuthType != awsAuth.AUTH_TYPE_SSO {
+			continue
+		}
+		modal.profiles.AddItem(profile.Name, "", 0, func() {
+			modal.selectedProfile = profile.Name
+			modal.handle.SetFocus(modal.button)
+		})
+	}
+}
+
 func (modal *SSOReauthenticationModal) Render(event *ipc.Event) tview.Primitive {
 	slog.Debug("SSOReauthenticationModal Render: Received event", "event", event)
 	switch event.Action {
+	case ipc.ACTION_PROFILES_CHANGED:
+		modal.loadProfiles()
 	case ipc.ACTION_MUST_REAUTHENTICATE_SSO:
 		modal.setMessage("Your SSO Session has expired. Please Reauthenticate to continue.")
+	case ipc.ACTION_PROGRESS:
+		if progress, err := ipc.Handle[ipc.ProgressData](event); err == nil {
+			modal.setProgress(progress.Message)
+		}
+	case ipc.ACTION_SSO_DEVICE_AUTHORIZATION:
+		if authorization, err := ipc.Handle[ipc.SSODeviceAuthorizationData](event); err == nil {
+			modal.setProgress(deviceAuthorizationText(authorization))
+		}
 	case ipc.ACTION_FINISH_REAUTHENTICATE_SSO:
 		// Reset the message in case this was a forced reauthentication
+		modal.refresh = nil
 		modal.setMessage("Refresh your AWS SSO Credentials")
 		modal.pages.HidePage("refreshing")
 		modal.pages.ShowPage("success")
+	case ipc.ACTION_CANCELLED:
+		modal.refresh = nil
+		modal.setMessage("SSO login was cancelled. Select a profile to try again.")
+		modal.pages.HidePage("refreshing")
+	case ipc.ACTION_TIMED_OUT:
+		modal.refresh = nil
+		modal.setMessage("SSO login timed out. Select a profile to try again.")
+		modal.pages.HidePage("refreshing")
+	case ipc.ACTION_FAILED:
+		modal.refresh = nil
+		modal.setMessage("SSO login failed. Select a profile to try again.")
+		modal.pages.HidePage("refreshing")
 	}
 
 	return modal.ui
 }
 
+// Tell the user where to approve the login. The page with the code filled in
+// is shown too since that is the one to open, the code is to compare against.
+func deviceAuthorizationText(authorization ipc.SSODeviceAuthorizationData) string {
+	url := authorization.VerificationURIComplete
+	if url == "" {
+		url = authorization.VerificationURI
+	}
+	return "Open the following page in your browser to approve the login:\n\n" +
+		url + "\n\n" +
+		"Confirm the code shown there is " + authorization.UserCode + "\n" +
+		"The code expires at " + authorization.ExpiresAt.Local().Format(time.Kitchen)
+}
+
 func (modal *SSOReauthenticationModal) GetName() string {
 	return modal.name
 }